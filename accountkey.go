@@ -0,0 +1,167 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+var (
+	ErrBadPassphrase      = errors.New("bad passphrase")
+	ErrNotPrivateKey      = errors.New("not a private key")
+	ErrPassphraseRequired = errors.New("passphrase required")
+)
+
+// A KeyType is a kind of account key to generate.
+type KeyType string
+
+const (
+	RSA2048   KeyType = "rsa2048"
+	RSA4096   KeyType = "rsa4096"
+	ECDSAP256 KeyType = "ecdsa-p256"
+	ECDSAP384 KeyType = "ecdsa-p384"
+	Ed25519   KeyType = "ed25519"
+)
+
+// keyContentType is the JWE content type of an encrypted key.
+const keyContentType = "jwk+json"
+
+// maxPBES2Count is the highest PBES2 iteration count accepted when
+// decrypting, to bound the work a crafted key can cause.
+const maxPBES2Count = 1000000
+
+// GenerateAccountKey creates a new account key.
+func GenerateAccountKey(typ KeyType) (crypto.Signer, error) {
+	switch typ {
+	case RSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case RSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case ECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case ECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case Ed25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKey, typ)
+	}
+}
+
+// MarshalPEMPrivateKey encodes a private key as a PKCS #8 PEM block.
+func MarshalPEMPrivateKey(key crypto.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParsePEMPrivateKey parses the first PEM block as a PKCS #8, PKCS #1
+// or SEC 1 private key.
+func ParsePEMPrivateKey(bs []byte) (crypto.PrivateKey, error) {
+	b, _ := pem.Decode(bs)
+	if b == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch b.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(b.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(b.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(b.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", b.Type)
+	}
+}
+
+// MarshalJWKPrivateKey encodes a private key as a JWK.
+func MarshalJWKPrivateKey(key crypto.PrivateKey) ([]byte, error) {
+	return json.Marshal(&jose.JSONWebKey{Key: key})
+}
+
+// ParseJWKPrivateKey parses a private key encoded as a JWK.
+func ParseJWKPrivateKey(bs []byte) (crypto.PrivateKey, error) {
+	var jwk jose.JSONWebKey
+	if err := json.Unmarshal(bs, &jwk); err != nil {
+		return nil, err
+	}
+	if jwk.IsPublic() {
+		return nil, ErrNotPrivateKey
+	}
+	return jwk.Key, nil
+}
+
+// KeyThumbprint returns the base64url-encoded SHA-256 JWK thumbprint
+// of a public key, as used in key authorizations.
+func KeyThumbprint(pub crypto.PublicKey) (string, error) {
+	tp, err := (&jose.JSONWebKey{Key: pub}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(tp), nil
+}
+
+// EncryptPrivateKey encodes a private key as a JWK and encrypts it
+// with a passphrase, using PBES2. The result is a compact JWE.
+func EncryptPrivateKey(key crypto.PrivateKey, passphrase []byte) (string, error) {
+	bs, err := MarshalJWKPrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	enc, err := jose.NewEncrypter(
+		jose.A256GCM,
+		jose.Recipient{Algorithm: jose.PBES2_HS512_A256KW, Key: passphrase},
+		(&jose.EncrypterOptions{}).WithContentType(keyContentType))
+	if err != nil {
+		return "", err
+	}
+	jwe, err := enc.Encrypt(bs)
+	if err != nil {
+		return "", err
+	}
+
+	return jwe.CompactSerialize()
+}
+
+// DecryptPrivateKey decrypts a key encrypted by EncryptPrivateKey.
+// Returns ErrBadPassphrase if the passphrase is wrong.
+func DecryptPrivateKey(s string, passphrase []byte) (crypto.PrivateKey, error) {
+	jwe, err := jose.ParseEncrypted(s)
+	if err != nil {
+		return nil, err
+	}
+	switch jose.KeyAlgorithm(jwe.Header.Algorithm) {
+	case jose.PBES2_HS256_A128KW, jose.PBES2_HS384_A192KW, jose.PBES2_HS512_A256KW:
+	default:
+		return nil, fmt.Errorf("unexpected key encryption algorithm: %s", jwe.Header.Algorithm)
+	}
+	if cty := jwe.Header.ExtraHeaders[jose.HeaderContentType]; cty != keyContentType {
+		return nil, fmt.Errorf("unexpected encrypted content type: %v", cty)
+	}
+	if p2c, ok := jwe.Header.ExtraHeaders["p2c"].(float64); ok && p2c > maxPBES2Count {
+		return nil, fmt.Errorf("PBES2 count too large: %d", int64(p2c))
+	}
+
+	bs, err := jwe.Decrypt(passphrase)
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+
+	return ParseJWKPrivateKey(bs)
+}
@@ -0,0 +1,95 @@
+package acme
+
+import (
+	"crypto"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateAccountKey(t *testing.T) {
+	for _, typ := range []KeyType{RSA2048, ECDSAP256, ECDSAP384, Ed25519} {
+		key, err := GenerateAccountKey(typ)
+		if err != nil {
+			t.Fatalf("[%s] GenerateAccountKey failed: %v", typ, err)
+		}
+
+		pemBS, err := MarshalPEMPrivateKey(key)
+		if err != nil {
+			t.Fatalf("[%s] MarshalPEMPrivateKey failed: %v", typ, err)
+		}
+		got, err := ParsePEMPrivateKey(pemBS)
+		if err != nil {
+			t.Fatalf("[%s] ParsePEMPrivateKey failed: %v", typ, err)
+		}
+		if !reflect.DeepEqual(got, key) {
+			t.Errorf("[%s] ParsePEMPrivateKey: got %v, want %v", typ, got, key)
+		}
+
+		jwk, err := MarshalJWKPrivateKey(key)
+		if err != nil {
+			t.Fatalf("[%s] MarshalJWKPrivateKey failed: %v", typ, err)
+		}
+		got, err = ParseJWKPrivateKey(jwk)
+		if err != nil {
+			t.Fatalf("[%s] ParseJWKPrivateKey failed: %v", typ, err)
+		}
+		if !publicKeysEqual(got.(crypto.Signer).Public(), key.Public()) {
+			t.Errorf("[%s] ParseJWKPrivateKey: got %v, want %v", typ, got, key)
+		}
+
+		if _, _, err := signingKey(key); err != nil {
+			t.Errorf("[%s] signingKey failed: %v", typ, err)
+		}
+	}
+
+	if _, err := GenerateAccountKey("dsa"); !errors.Is(err, ErrUnsupportedKey) {
+		t.Errorf("GenerateAccountKey(dsa): got %v, want %v", err, ErrUnsupportedKey)
+	}
+}
+
+func TestParseJWKPrivateKeyPublic(t *testing.T) {
+	in := `{"kty": "EC", "crv": "P-256", "x": "MKBCTNIcKUSDii11ySs3526iDZ8AiTo7Tu6KPAqv7D4", "y": "4Etl6SRW2YiLUrN5vfvVHuhp7x8PxltmWWlbbM4IFyM"}`
+	if _, err := ParseJWKPrivateKey([]byte(in)); err != ErrNotPrivateKey {
+		t.Errorf("ParseJWKPrivateKey: got %v, want %v", err, ErrNotPrivateKey)
+	}
+}
+
+func TestKeyThumbprint(t *testing.T) {
+	// From RFC 7638, Section 3.1.
+	jwk := mustUnmarshalJWK(`{
+		"kty": "RSA",
+		"n": "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		"e": "AQAB"
+	}`)
+	got, err := KeyThumbprint(jwk.Key)
+	if err != nil {
+		t.Fatalf("KeyThumbprint failed: %v", err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Errorf("KeyThumbprint: got %q, want %q", got, want)
+	}
+}
+
+func TestEncryptPrivateKey(t *testing.T) {
+	key, err := GenerateAccountKey(Ed25519)
+	if err != nil {
+		t.Fatalf("GenerateAccountKey failed: %v", err)
+	}
+	enc, err := EncryptPrivateKey(key, []byte("secret"))
+	if err != nil {
+		t.Fatalf("EncryptPrivateKey failed: %v", err)
+	}
+
+	got, err := DecryptPrivateKey(enc, []byte("secret"))
+	if err != nil {
+		t.Fatalf("DecryptPrivateKey failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, key) {
+		t.Errorf("DecryptPrivateKey: got %v, want %v", got, key)
+	}
+
+	if _, err := DecryptPrivateKey(enc, []byte("wrong")); err != ErrBadPassphrase {
+		t.Errorf("DecryptPrivateKey(wrong): got %v, want %v", err, ErrBadPassphrase)
+	}
+}
@@ -0,0 +1,160 @@
+package acme
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// AccountState is a serializable description of an ACME account,
+// enough to recreate a ClientAccount after a restart. It contains
+// the private key, so it must be stored securely.
+type AccountState struct {
+	// DirectoryURI is the ACME directory URI of the server.
+	DirectoryURI string `json:"directoryURI"`
+
+	// URI is the registration URI of the account.
+	URI string `json:"uri"`
+
+	// Key is the private account key.
+	Key crypto.PrivateKey `json:"-"`
+
+	ContactURIs  []string  `json:"contactURIs,omitempty"`
+	AgreementURI string    `json:"agreementURI,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// accountStateJSON is the encoded form of AccountState. On decoding,
+// the key can be given either as a JWK, a PEM block or a JWK
+// encrypted with EncryptPrivateKey.
+type accountStateJSON struct {
+	*AccountState
+
+	JWK          *jose.JSONWebKey `json:"key,omitempty"`
+	KeyPEM       string           `json:"keyPEM,omitempty"`
+	EncryptedKey string           `json:"encryptedKey,omitempty"`
+}
+
+// NewAccountState creates a state from an account, its private key
+// and registration. reg may be nil. CreatedAt is set to the current
+// time.
+func NewAccountState(a *ClientAccount, key crypto.PrivateKey, reg *Registration) *AccountState {
+	st := &AccountState{
+		DirectoryURI: a.dirURI,
+		URI:          a.URI,
+		Key:          key,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if reg != nil {
+		st.ContactURIs = reg.ContactURIs
+		st.AgreementURI = reg.AgreementURI
+	}
+	return st
+}
+
+// Marshal encodes the state as JSON, with the key as a JWK.
+func (st *AccountState) Marshal() ([]byte, error) {
+	if st.Key == nil {
+		return nil, errors.New("account state has no key")
+	}
+	return json.Marshal(&accountStateJSON{
+		AccountState: st,
+		JWK:          &jose.JSONWebKey{Key: st.Key},
+	})
+}
+
+// MarshalEncrypted encodes the state as JSON, with the key encrypted
+// with a passphrase. Decode it with UnmarshalEncryptedAccountState.
+func (st *AccountState) MarshalEncrypted(passphrase []byte) ([]byte, error) {
+	if st.Key == nil {
+		return nil, errors.New("account state has no key")
+	}
+	enc, err := EncryptPrivateKey(st.Key, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&accountStateJSON{
+		AccountState: st,
+		EncryptedKey: enc,
+	})
+}
+
+// UnmarshalAccountState decodes a state encoded by Marshal. A PEM
+// encoded key, in a "keyPEM" field, is accepted instead of the JWK.
+// Returns ErrPassphraseRequired if the key is encrypted.
+func UnmarshalAccountState(bs []byte) (*AccountState, error) {
+	return unmarshalAccountState(bs, nil)
+}
+
+// UnmarshalEncryptedAccountState decodes a state encoded by
+// MarshalEncrypted. Unencrypted states are also accepted.
+func UnmarshalEncryptedAccountState(bs, passphrase []byte) (*AccountState, error) {
+	return unmarshalAccountState(bs, passphrase)
+}
+
+func unmarshalAccountState(bs, passphrase []byte) (*AccountState, error) {
+	st := &AccountState{}
+	v := &accountStateJSON{AccountState: st}
+	if err := json.Unmarshal(bs, v); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case v.JWK != nil:
+		if v.JWK.IsPublic() {
+			return nil, errors.New("account state key is not a private key")
+		}
+		st.Key = v.JWK.Key
+
+	case v.KeyPEM != "":
+		key, err := ParsePEMPrivateKey([]byte(v.KeyPEM))
+		if err != nil {
+			return nil, err
+		}
+		st.Key = key
+
+	case v.EncryptedKey != "":
+		if passphrase == nil {
+			return nil, ErrPassphraseRequired
+		}
+		key, err := DecryptPrivateKey(v.EncryptedKey, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		st.Key = key
+
+	default:
+		return nil, errors.New("account state has no key")
+	}
+	if st.DirectoryURI == "" {
+		return nil, errors.New("account state has no directory URI")
+	}
+
+	return st, nil
+}
+
+// LoadClientAccount creates a ClientAccount from a state. If verify
+// is true, the registration is fetched from the server to check that
+// the account still exists.
+func LoadClientAccount(st *AccountState, verify bool) (*ClientAccount, error) {
+	if st.URI == "" {
+		return nil, errors.New("account state has no account URI")
+	}
+
+	a, err := NewClientAccount(st.DirectoryURI, st.URI, st.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	if verify {
+		if _, err := a.Registration(); err != nil {
+			return nil, fmt.Errorf("verifying account %s: %v", st.URI, err)
+		}
+	}
+
+	return a, nil
+}
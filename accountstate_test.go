@@ -0,0 +1,147 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tommie/acme-go/protocol"
+)
+
+func TestAccountStateMarshal(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	st := &AccountState{
+		DirectoryURI: "http://example.com/directory",
+		URI:          "http://example.com/reg/1",
+		Key:          key,
+		ContactURIs:  []string{"mailto:acme@example.com"},
+		AgreementURI: "http://example.com/tos",
+		CreatedAt:    time.Unix(1000, 0).UTC(),
+	}
+
+	bs, err := st.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	got, err := UnmarshalAccountState(bs)
+	if err != nil {
+		t.Fatalf("UnmarshalAccountState failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, st) {
+		t.Errorf("UnmarshalAccountState: got %+v, want %+v", got, st)
+	}
+}
+
+func TestUnmarshalAccountStatePEM(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey failed: %v", err)
+	}
+	bs, err := json.Marshal(map[string]string{
+		"directoryURI": "http://example.com/directory",
+		"uri":          "http://example.com/reg/1",
+		"keyPEM":       string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	got, err := UnmarshalAccountState(bs)
+	if err != nil {
+		t.Fatalf("UnmarshalAccountState failed: %v", err)
+	}
+	if !reflect.DeepEqual(got.Key, key) {
+		t.Errorf("UnmarshalAccountState Key: got %v, want %v", got.Key, key)
+	}
+}
+
+func TestAccountStateMarshalEncrypted(t *testing.T) {
+	key, err := GenerateAccountKey(ECDSAP256)
+	if err != nil {
+		t.Fatalf("GenerateAccountKey failed: %v", err)
+	}
+	st := &AccountState{
+		DirectoryURI: "http://example.com/directory",
+		URI:          "http://example.com/reg/1",
+		Key:          key,
+		CreatedAt:    time.Unix(1000, 0).UTC(),
+	}
+
+	bs, err := st.MarshalEncrypted([]byte("secret"))
+	if err != nil {
+		t.Fatalf("MarshalEncrypted failed: %v", err)
+	}
+	if _, err := UnmarshalAccountState(bs); err != ErrPassphraseRequired {
+		t.Errorf("UnmarshalAccountState: got %v, want %v", err, ErrPassphraseRequired)
+	}
+	if _, err := UnmarshalEncryptedAccountState(bs, []byte("wrong")); err != ErrBadPassphrase {
+		t.Errorf("UnmarshalEncryptedAccountState(wrong): got %v, want %v", err, ErrBadPassphrase)
+	}
+	got, err := UnmarshalEncryptedAccountState(bs, []byte("secret"))
+	if err != nil {
+		t.Fatalf("UnmarshalEncryptedAccountState failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, st) {
+		t.Errorf("UnmarshalEncryptedAccountState: got %+v, want %+v", got, st)
+	}
+}
+
+func TestUnmarshalAccountStateErrors(t *testing.T) {
+	tsts := []struct {
+		name string
+		in   string
+	}{
+		{name: "no key", in: `{"directoryURI": "http://example.com/directory"}`},
+		{name: "public key", in: `{"directoryURI": "http://example.com/directory", "key": {"kty": "EC", "crv": "P-256", "x": "MKBCTNIcKUSDii11ySs3526iDZ8AiTo7Tu6KPAqv7D4", "y": "4Etl6SRW2YiLUrN5vfvVHuhp7x8PxltmWWlbbM4IFyM"}}`},
+		{name: "bad PEM", in: `{"directoryURI": "http://example.com/directory", "keyPEM": "garbage"}`},
+	}
+
+	for _, tst := range tsts {
+		if _, err := UnmarshalAccountState([]byte(tst.in)); err == nil {
+			t.Errorf("[%s] UnmarshalAccountState: got success, want error", tst.name)
+		}
+	}
+}
+
+func TestLoadClientAccount(t *testing.T) {
+	_, hts := newFakeACMEServer()
+	defer hts.Close()
+
+	a, reg, err := RegisterAccount(hts.URL+protocol.DirectoryPath, testJWK.Key, WithContactURIs("mailto:acme@example.com"))
+	if err != nil {
+		t.Fatalf("RegisterAccount failed: %v", err)
+	}
+	st := NewAccountState(a, testJWK.Key, reg)
+	if want := []string{"mailto:acme@example.com"}; !reflect.DeepEqual(st.ContactURIs, want) {
+		t.Errorf("NewAccountState ContactURIs: got %v, want %v", st.ContactURIs, want)
+	}
+
+	got, err := LoadClientAccount(st, true)
+	if err != nil {
+		t.Fatalf("LoadClientAccount failed: %v", err)
+	}
+	if got.URI != a.URI {
+		t.Errorf("LoadClientAccount URI: got %v, want %v", got.URI, a.URI)
+	}
+
+	st.URI = hts.URL + "/missing"
+	if _, err := LoadClientAccount(st, true); err == nil {
+		t.Errorf("LoadClientAccount(missing): got success, want error")
+	}
+	if _, err := LoadClientAccount(st, false); err != nil {
+		t.Errorf("LoadClientAccount(missing, no verify) failed: %v", err)
+	}
+}
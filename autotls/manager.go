@@ -0,0 +1,283 @@
+// Package autotls obtains certificates on demand for TLS servers,
+// answering tls-alpn-01 challenges in the same handshake path and
+// renewing certificates in the background.
+package autotls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tommie/acme-go"
+	"github.com/tommie/acme-go/protocol"
+	"github.com/tommie/acme-go/renew"
+	"github.com/tommie/acme-go/storage"
+	"gopkg.in/square/go-jose.v2"
+)
+
+var (
+	ErrHostNotAllowed = errors.New("host not allowed")
+	ErrNoServerName   = errors.New("missing server name")
+)
+
+// A HostPolicy decides whether a certificate may be issued for a
+// host name. It returns an error to deny it.
+type HostPolicy func(host string) error
+
+// AllowHosts returns a policy allowing only the given host names.
+func AllowHosts(hosts ...string) HostPolicy {
+	allowed := map[string]bool{}
+	for _, h := range hosts {
+		allowed[strings.ToLower(h)] = true
+	}
+	return func(host string) error {
+		if !allowed[host] {
+			return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+		}
+		return nil
+	}
+}
+
+// A Manager provides certificates to a tls.Config through
+// GetCertificate. Certificates are loaded from storage, or issued
+// when first requested for a host allowed by the host policy. They
+// are named by host name in storage. Its functions are
+// concurrency-safe.
+type Manager struct {
+	s       storage.Storage
+	account string
+	policy  HostPolicy
+	alpn    *acme.TLSALPN01Solver
+	solvers acme.TypeSolver
+
+	issuerOpts []acme.CertificateIssuerOpt
+	renewOpts  []renew.ManagerOpt
+	renewer    *renew.Manager
+
+	mu      sync.Mutex
+	certs   map[string]*tls.Certificate
+	pending map[string]*obtainCall
+}
+
+// obtainCall is an ongoing load or issuance, waited for by all
+// handshakes for the same host.
+type obtainCall struct {
+	done chan struct{}
+	cert *tls.Certificate
+	err  error
+}
+
+// A ManagerOpt is an option for NewManager.
+type ManagerOpt func(*Manager)
+
+// WithHostPolicy sets the policy for which host names certificates
+// may be issued. By default, no host names are allowed, and only
+// certificates already in storage are served.
+func WithHostPolicy(p HostPolicy) ManagerOpt {
+	return func(m *Manager) {
+		m.policy = p
+	}
+}
+
+// WithSolver adds a solver for a challenge type, in addition to the
+// built-in tls-alpn-01 solver.
+func WithSolver(typ protocol.ChallengeType, s acme.Solver) ManagerOpt {
+	return func(m *Manager) {
+		m.solvers[typ] = s
+	}
+}
+
+// WithIssuerOpts sets options for the CertificateIssuer.
+func WithIssuerOpts(opts ...acme.CertificateIssuerOpt) ManagerOpt {
+	return func(m *Manager) {
+		m.issuerOpts = append(m.issuerOpts, opts...)
+	}
+}
+
+// WithRenewOpts sets options for the renewal manager, e.g. deploy
+// hooks or the renewal window.
+func WithRenewOpts(opts ...renew.ManagerOpt) ManagerOpt {
+	return func(m *Manager) {
+		m.renewOpts = append(m.renewOpts, opts...)
+	}
+}
+
+// NewManager creates a manager for certificates of an account in s,
+// issued through ia. The account key is used to answer tls-alpn-01
+// challenges. If ia is also a storage.CertificateFetcher, like
+// *acme.ClientAccount, it is used to fetch issuer chains.
+func NewManager(s storage.Storage, account string, ia acme.IssuingAccount, accountKey *jose.JSONWebKey, opts ...ManagerOpt) *Manager {
+	m := &Manager{
+		s:       s,
+		account: account,
+		policy: func(host string) error {
+			return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+		},
+		alpn:    acme.NewTLSALPN01Solver(accountKey, 1),
+		certs:   map[string]*tls.Certificate{},
+		pending: map[string]*obtainCall{},
+	}
+	m.solvers = acme.TypeSolver{protocol.ChallengeTLSALPN01: m.alpn}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	cf, _ := ia.(storage.CertificateFetcher)
+	ropts := append([]renew.ManagerOpt{renew.WithDeployHook(m.deploy)}, m.renewOpts...)
+	m.renewer = renew.NewManager(s, account, acme.NewCertificateIssuer(ia, m.issuerOpts...), m.solvers, cf, ropts...)
+
+	return m
+}
+
+// TLSConfig returns a TLS configuration using the manager, which also
+// accepts tls-alpn-01 validation requests.
+func (m *Manager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: m.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1", acme.TLSALPN01Protocol},
+	}
+}
+
+// GetCertificate returns a certificate for the server name of a
+// handshake, for use as tls.Config.GetCertificate. A missing
+// certificate is issued before returning, if the host policy allows
+// it. tls-alpn-01 validation handshakes get the challenge
+// certificate.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if acme.IsTLSALPN01Hello(hello) {
+		return m.alpn.GetCertificate(hello)
+	}
+
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if name == "" {
+		return nil, ErrNoServerName
+	}
+
+	m.mu.Lock()
+	cert, ok := m.certs[name]
+	m.mu.Unlock()
+	if ok && time.Now().Before(cert.Leaf.NotAfter) {
+		return cert, nil
+	}
+
+	return m.obtain(name)
+}
+
+// Run loads managed certificates from storage and renews them in the
+// background, until Stop is called.
+func (m *Manager) Run() error {
+	if err := m.renewer.Load(); err != nil {
+		return err
+	}
+	m.renewer.Run()
+	return nil
+}
+
+// Stop makes Run return.
+func (m *Manager) Stop() {
+	m.renewer.Stop()
+}
+
+// Status returns the renewal schedule of all managed certificates.
+func (m *Manager) Status() []renew.CertificateStatus {
+	return m.renewer.Status()
+}
+
+// obtain loads or issues a certificate. Concurrent calls for the same
+// name share the result.
+func (m *Manager) obtain(name string) (*tls.Certificate, error) {
+	m.mu.Lock()
+	if c, ok := m.pending[name]; ok {
+		m.mu.Unlock()
+		<-c.done
+		return c.cert, c.err
+	}
+	c := &obtainCall{done: make(chan struct{})}
+	m.pending[name] = c
+	m.mu.Unlock()
+
+	c.cert, c.err = m.load(name)
+
+	m.mu.Lock()
+	delete(m.pending, name)
+	m.mu.Unlock()
+	close(c.done)
+
+	return c.cert, c.err
+}
+
+// load returns a valid certificate from storage, or issues one if
+// there is none and the host policy allows it.
+func (m *Manager) load(name string) (*tls.Certificate, error) {
+	b, err := storage.GetBundle(m.s, m.account, name)
+	if err != nil && err != storage.ErrNotFound {
+		return nil, err
+	}
+	if err == nil {
+		cert, err := tlsCertificate(b)
+		if err != nil {
+			return nil, err
+		}
+		if time.Now().Before(cert.Leaf.NotAfter) {
+			m.mu.Lock()
+			m.certs[name] = cert
+			m.mu.Unlock()
+			return cert, nil
+		}
+	}
+
+	if err := m.policy(name); err != nil {
+		return nil, err
+	}
+	if err := m.renewer.Manage(name, []string{name}); err != nil {
+		return nil, err
+	}
+	// A failing user deploy hook doesn't stop us from serving the
+	// installed certificate. The error is reported by Status.
+	rerr := m.renewer.Renew(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cert, ok := m.certs[name]
+	if ok && time.Now().Before(cert.Leaf.NotAfter) {
+		return cert, nil
+	}
+	if rerr != nil {
+		return nil, rerr
+	}
+	return nil, fmt.Errorf("no certificate for %s after issuance", name)
+}
+
+// deploy is the renewal manager's deploy hook, replacing the served
+// certificate.
+func (m *Manager) deploy(name string, b *storage.Bundle) error {
+	cert, err := tlsCertificate(b)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.certs[name] = cert
+	return nil
+}
+
+// tlsCertificate converts a bundle to a certificate for tls.Config.
+func tlsCertificate(b *storage.Bundle) (*tls.Certificate, error) {
+	leaf, err := x509.ParseCertificate(b.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: append([][]byte{b.Certificate}, b.Chain...),
+		PrivateKey:  b.Key,
+		Leaf:        leaf,
+	}, nil
+}
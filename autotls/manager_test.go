@@ -0,0 +1,267 @@
+package autotls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tommie/acme-go"
+	"github.com/tommie/acme-go/protocol"
+	"github.com/tommie/acme-go/renew"
+	"github.com/tommie/acme-go/storage"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestManagerGetCertificate(t *testing.T) {
+	s := mustNewStorage(t)
+	var m *Manager
+	ia := newStubIssuingAccount()
+	ia.validate = func(name string) error {
+		// The server connects back with acme-tls/1.
+		cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: name, SupportedProtos: []string{acme.TLSALPN01Protocol}})
+		if err != nil {
+			return err
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return err
+		}
+		if len(leaf.DNSNames) != 1 || leaf.DNSNames[0] != name {
+			return fmt.Errorf("challenge certificate names %v, want [%s]", leaf.DNSNames, name)
+		}
+		return nil
+	}
+	m = NewManager(s, "acct", ia, testJWK, WithHostPolicy(AllowHosts("example.com")))
+
+	var wg sync.WaitGroup
+	certs := make([]*tls.Certificate, 4)
+	errs := make([]error, len(certs))
+	for i := range certs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			certs[i], errs[i] = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "Example.com."})
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range certs {
+		if errs[i] != nil {
+			t.Fatalf("GetCertificate failed: %v", errs[i])
+		}
+		if certs[i] != certs[0] {
+			t.Errorf("GetCertificate: got different certificates for concurrent handshakes")
+		}
+	}
+	if got := certs[0].Leaf.DNSNames; len(got) != 1 || got[0] != "example.com" {
+		t.Errorf("GetCertificate DNSNames: got %v, want [example.com]", got)
+	}
+	if ia.issued != 1 {
+		t.Errorf("GetCertificate issued: got %d, want 1", ia.issued)
+	}
+	if ia.validated != 1 {
+		t.Errorf("GetCertificate validated: got %d, want 1", ia.validated)
+	}
+
+	// Another manager finds the certificate in storage.
+	m2 := NewManager(s, "acct", ia, testJWK)
+	got, err := m2.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	if err != nil {
+		t.Fatalf("GetCertificate failed: %v", err)
+	}
+	if !got.Leaf.Equal(certs[0].Leaf) {
+		t.Errorf("GetCertificate: got a different certificate from storage")
+	}
+	if ia.issued != 1 {
+		t.Errorf("GetCertificate issued: got %d, want 1", ia.issued)
+	}
+
+	if sts := m.Status(); len(sts) != 1 || sts[0].Name != "example.com" {
+		t.Errorf("Status: got %+v, want example.com", sts)
+	}
+}
+
+func TestManagerGetCertificateDenied(t *testing.T) {
+	ia := newStubIssuingAccount()
+	m := NewManager(mustNewStorage(t), "acct", ia, testJWK, WithHostPolicy(AllowHosts("example.com")))
+
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.org"}); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("GetCertificate: got %v, want %v", err, ErrHostNotAllowed)
+	}
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{}); err != ErrNoServerName {
+		t.Errorf("GetCertificate: got %v, want %v", err, ErrNoServerName)
+	}
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com", SupportedProtos: []string{acme.TLSALPN01Protocol}}); err == nil {
+		t.Errorf("GetCertificate(acme-tls/1): got success, want error")
+	}
+
+	// The default policy denies everything.
+	m = NewManager(mustNewStorage(t), "acct", ia, testJWK)
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"}); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("GetCertificate: got %v, want %v", err, ErrHostNotAllowed)
+	}
+	if ia.issued != 0 {
+		t.Errorf("GetCertificate issued: got %d, want 0", ia.issued)
+	}
+}
+
+func TestManagerGetCertificateDeployError(t *testing.T) {
+	ia := newStubIssuingAccount()
+	hookErr := errors.New("mock error")
+	hook := func(name string, b *storage.Bundle) error { return hookErr }
+	m := NewManager(mustNewStorage(t), "acct", ia, testJWK, WithHostPolicy(AllowHosts("example.com")), WithRenewOpts(renew.WithDeployHook(hook)))
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	if err != nil {
+		t.Fatalf("GetCertificate failed: %v", err)
+	}
+	if got := cert.Leaf.DNSNames; len(got) != 1 || got[0] != "example.com" {
+		t.Errorf("GetCertificate DNSNames: got %v, want [example.com]", got)
+	}
+	if sts := m.Status(); len(sts) != 1 || sts[0].DeployError == nil {
+		t.Errorf("Status: got %+v, want a deploy error", sts)
+	}
+}
+
+func TestManagerTLSConfig(t *testing.T) {
+	m := NewManager(mustNewStorage(t), "acct", newStubIssuingAccount(), testJWK)
+	cfg := m.TLSConfig()
+	if cfg.GetCertificate == nil {
+		t.Errorf("TLSConfig GetCertificate: got nil")
+	}
+	var found bool
+	for _, p := range cfg.NextProtos {
+		found = found || p == acme.TLSALPN01Protocol
+	}
+	if !found {
+		t.Errorf("TLSConfig NextProtos: got %v, want %s included", cfg.NextProtos, acme.TLSALPN01Protocol)
+	}
+}
+
+var testJWK = func() *jose.JSONWebKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return &jose.JSONWebKey{Key: key.Public()}
+}()
+
+func mustNewStorage(t *testing.T) storage.Storage {
+	s, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+	return s
+}
+
+// stubIssuingAccount is an acme.IssuingAccount offering tls-alpn-01
+// challenges. It signs certificates with a test CA.
+type stubIssuingAccount struct {
+	caKey *ecdsa.PrivateKey
+	ca    *x509.Certificate
+
+	// validate is called with the identifier name on
+	// ValidateChallenge.
+	validate func(name string) error
+
+	mu        sync.Mutex
+	names     map[string]string
+	issued    int
+	validated int
+}
+
+func newStubIssuingAccount() *stubIssuingAccount {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		panic(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	return &stubIssuingAccount{caKey: key, ca: ca, names: map[string]string{}}
+}
+
+func (ia *stubIssuingAccount) AuthorizeIdentity(id acme.Identifier) (*acme.Authorization, error) {
+	name := string(id.(acme.DNSIdentifier))
+	uri := "/authz/" + name
+
+	ia.mu.Lock()
+	ia.names[uri+"/0"] = name
+	ia.mu.Unlock()
+
+	return &acme.Authorization{
+		Authorization: protocol.Authorization{
+			Challenges: []protocol.Challenge{
+				&protocol.TLSALPN01Challenge{Resource: protocol.ResourceChallenge, Type: protocol.ChallengeTLSALPN01, URI: uri + "/0", Token: "tok"},
+			},
+			Combinations: [][]int{{0}},
+		},
+		Status:     protocol.StatusPending,
+		Identifier: id,
+		URI:        uri,
+	}, nil
+}
+
+func (ia *stubIssuingAccount) Authorization(uri string) (*acme.Authorization, error) {
+	return &acme.Authorization{Status: protocol.StatusValid, URI: uri}, nil
+}
+
+func (ia *stubIssuingAccount) ValidateChallenge(uri string, resp protocol.Response) (protocol.Challenge, error) {
+	ia.mu.Lock()
+	name := ia.names[uri]
+	ia.validated++
+	ia.mu.Unlock()
+
+	if ia.validate != nil {
+		if err := ia.validate(name); err != nil {
+			return nil, err
+		}
+	}
+	return &protocol.TLSALPN01Challenge{Type: protocol.ChallengeTLSALPN01, URI: uri, Status: protocol.StatusValid}, nil
+}
+
+func (ia *stubIssuingAccount) IssueCertificate(csr []byte) (*acme.Certificate, error) {
+	ia.mu.Lock()
+	defer ia.mu.Unlock()
+
+	req, err := x509.ParseCertificateRequest(csr)
+	if err != nil {
+		return nil, err
+	}
+	ia.issued++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(ia.issued + 1)),
+		Subject:      req.Subject,
+		DNSNames:     req.DNSNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ia.ca, req.PublicKey, ia.caKey)
+	if err != nil {
+		return nil, err
+	}
+	return &acme.Certificate{Bytes: der}, nil
+}
@@ -0,0 +1,97 @@
+package acme
+
+import (
+	"crypto/x509"
+	"errors"
+)
+
+// A BatchResult is the outcome of issuing one certificate in a call
+// to AuthorizeAndIssueBatch.
+type BatchResult struct {
+	Certificate *Certificate
+	Err         error
+}
+
+// AuthorizeAndIssueBatch issues a certificate for each signing
+// request. The union of identifiers is authorized once, with all
+// challenges solved in shared calls to the solver. The returned
+// results have the same order as csrs.
+//
+// A signing request that cannot be parsed, needs an identifier the
+// server rejected or whose authorization failed, or is rejected by
+// the server only fails its own result. Other errors, such as
+// cancellation, fail the whole batch and are returned as err.
+func (ci *CertificateIssuer) AuthorizeAndIssueBatch(csrs [][]byte, s Solver) ([]*BatchResult, error) {
+	ret := make([]*BatchResult, len(csrs))
+	csrIDs := make([][]Identifier, len(csrs))
+	var ids []Identifier
+	seen := map[string]bool{}
+	for i, csr := range csrs {
+		ret[i] = &BatchResult{}
+		pcsr, err := x509.ParseCertificateRequest(csr)
+		if err != nil {
+			ret[i].Err = err
+			continue
+		}
+		csrIDs[i] = csrIdentifiers(pcsr)
+		for _, id := range csrIDs[i] {
+			if !seen[id.String()] {
+				seen[id.String()] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	// Identifiers the server rejects only fail the requests
+	// needing them.
+	pending := make([]*Authorization, len(ids))
+	idErrs := make([]error, len(ids))
+	err := ci.parallel(len(ids), func(i int, quit <-chan struct{}) error {
+		pending[i], idErrs[i] = ci.authorizeID(ids[i])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	failed := map[string]error{}
+	var as []*Authorization
+	for i, a := range pending {
+		if idErrs[i] != nil {
+			failed[ids[i].String()] = idErrs[i]
+		} else if a != nil {
+			as = append(as, a)
+		}
+	}
+
+	if err := ci.authorize(s, as); err != nil {
+		var aerr *AuthorizationError
+		if !errors.As(err, &aerr) {
+			return nil, err
+		}
+		for _, a := range aerr.Authorizations {
+			failed[a.Identifier.String()] = err
+		}
+	}
+	for i, ids := range csrIDs {
+		for _, id := range ids {
+			if err, ok := failed[id.String()]; ok {
+				ret[i].Err = err
+				break
+			}
+		}
+	}
+
+	err = ci.parallel(len(csrs), func(i int, quit <-chan struct{}) error {
+		if ret[i].Err != nil {
+			return nil
+		}
+		ret[i].Certificate, ret[i].Err = ci.issue(csrs[i])
+		ci.emit(&IssuedEvent{Certificate: ret[i].Certificate, Err: ret[i].Err})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
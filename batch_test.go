@@ -0,0 +1,181 @@
+package acme
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/tommie/acme-go/protocol"
+)
+
+func TestCertificateIssuerAuthorizeAndIssueBatch(t *testing.T) {
+	csrs := [][]byte{
+		mustGenerateCSR("a.example.com", "b.example.com"),
+		mustGenerateCSR("b.example.com", "c.example.com"),
+		[]byte("garbage"),
+	}
+
+	tsts := []struct {
+		name     string
+		rejected map[string]bool
+		invalid  map[string]bool
+
+		wantCerts []bool
+	}{
+		{
+			name: "all",
+
+			wantCerts: []bool{true, true, false},
+		},
+		{
+			name:    "c invalid",
+			invalid: map[string]bool{"/authz/dns:c.example.com": true},
+
+			wantCerts: []bool{true, false, false},
+		},
+		{
+			name:     "c rejected",
+			rejected: map[string]bool{"dns:c.example.com": true},
+
+			wantCerts: []bool{true, false, false},
+		},
+		{
+			name:    "c already invalid",
+			invalid: map[string]bool{"dns:c.example.com": true},
+
+			wantCerts: []bool{true, false, false},
+		},
+	}
+
+	for _, tst := range tsts {
+		s := &stubSolver{
+			costs: map[protocol.ChallengeType]float64{protocol.ChallengeHTTP01: 1},
+			resps: map[protocol.ChallengeType]protocol.Response{
+				protocol.ChallengeHTTP01: &protocol.HTTP01Response{Type: protocol.ChallengeHTTP01},
+			},
+		}
+		var mu sync.Mutex
+		var ids []string
+		var issued int
+		ia := &stubIssuingAccount{
+			authzID: func(id Identifier) (*Authorization, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				ids = append(ids, id.String())
+				if tst.rejected[id.String()] {
+					return nil, &protocol.ServerError{StatusCode: 403, Problem: &protocol.Problem{Type: protocol.Unauthorized}}
+				}
+				if tst.invalid[id.String()] {
+					return &Authorization{Identifier: id, Status: protocol.StatusInvalid}, nil
+				}
+				return testPendingAuthorization("/authz/"+id.String(), id), nil
+			},
+			authz: func(uri string) (*Authorization, error) {
+				if tst.invalid[uri] {
+					return &Authorization{URI: uri, Status: protocol.StatusInvalid}, nil
+				}
+				return &Authorization{URI: uri, Status: protocol.StatusValid}, nil
+			},
+			validate: func(uri string, resp protocol.Response) (protocol.Challenge, error) {
+				return &protocol.GenericChallenge{Type: resp.GetType(), Status: protocol.StatusPending}, nil
+			},
+			issue: func(csr []byte) (*Certificate, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				issued++
+				return &Certificate{URI: "http://example.com/cert/4"}, nil
+			},
+		}
+
+		got, err := NewCertificateIssuer(ia).AuthorizeAndIssueBatch(csrs, s)
+		if err != nil {
+			t.Errorf("[%s] AuthorizeAndIssueBatch failed: %v", tst.name, err)
+			continue
+		}
+
+		if want := []string{"dns:a.example.com", "dns:b.example.com", "dns:c.example.com"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("[%s] AuthorizeAndIssueBatch ids: got %v, want %v", tst.name, ids, want)
+		}
+		if s.stopped != 1 {
+			t.Errorf("[%s] AuthorizeAndIssueBatch solver sessions: got %v, want 1", tst.name, s.stopped)
+		}
+		var gotCerts []bool
+		for i, res := range got {
+			gotCerts = append(gotCerts, res.Certificate != nil)
+			if (res.Certificate == nil) == (res.Err == nil) {
+				t.Errorf("[%s] AuthorizeAndIssueBatch result %d: got %+v, want either certificate or error", tst.name, i, res)
+			}
+		}
+		if !reflect.DeepEqual(gotCerts, tst.wantCerts) {
+			t.Errorf("[%s] AuthorizeAndIssueBatch certificates: got %v, want %v", tst.name, gotCerts, tst.wantCerts)
+		}
+	}
+}
+
+func TestCertificateIssuerAuthorizeAndIssueBatchReplacing(t *testing.T) {
+	var mu sync.Mutex
+	var replaced []string
+	ia := &stubReplacingAccount{
+		stubIssuingAccount: stubIssuingAccount{
+			authzID: func(id Identifier) (*Authorization, error) {
+				return &Authorization{Status: protocol.StatusValid}, nil
+			},
+			issue: func(csr []byte) (*Certificate, error) {
+				t.Errorf("IssueCertificate called, want ReplaceCertificate")
+				return nil, ErrCanceled
+			},
+		},
+		replace: func(csr []byte, certID string) (*Certificate, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			replaced = append(replaced, certID)
+			return &Certificate{URI: "http://example.com/cert/replacement"}, nil
+		},
+	}
+
+	got, err := NewCertificateIssuer(ia).Replacing("AQI.Aw").AuthorizeAndIssueBatch([][]byte{testCSR, testCSR}, &stubSolver{})
+	if err != nil {
+		t.Fatalf("AuthorizeAndIssueBatch failed: %v", err)
+	}
+	for i, res := range got {
+		if res.Err != nil {
+			t.Errorf("AuthorizeAndIssueBatch result %d: got %v, want nil error", i, res.Err)
+		}
+	}
+	if want := []string{"AQI.Aw", "AQI.Aw"}; !reflect.DeepEqual(replaced, want) {
+		t.Errorf("AuthorizeAndIssueBatch replaced: got %v, want %v", replaced, want)
+	}
+}
+
+func TestCertificateIssuerAuthorizeAndIssueBatchCancel(t *testing.T) {
+	var ci *CertificateIssuer
+	ia := &stubIssuingAccount{
+		authzID: func(id Identifier) (*Authorization, error) {
+			ci.Cancel()
+			return &Authorization{Status: protocol.StatusValid}, nil
+		},
+	}
+
+	ci = NewCertificateIssuer(ia)
+	_, err := ci.AuthorizeAndIssueBatch([][]byte{testCSR, testCSR}, &stubSolver{})
+	if err != ErrCanceled {
+		t.Fatalf("AuthorizeAndIssueBatch error: got %v, want %v", err, ErrCanceled)
+	}
+}
+
+// mustGenerateCSR creates a CSR with the first name as common name
+// and all names as DNS names.
+func mustGenerateCSR(names ...string) []byte {
+	cr := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: names[0]},
+		DNSNames: names,
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, cr, testJWK.Key)
+	if err != nil {
+		panic(err)
+	}
+	return csr
+}
@@ -2,14 +2,13 @@ package acme
 
 import (
 	"crypto"
-	"crypto/ecdsa"
-	"crypto/rsa"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/tommie/acme-go/protocol"
@@ -21,7 +20,8 @@ var (
 )
 
 // ClientAccount represents a client for connecting to an ACME
-// account. Instances are not concurrency-safe.
+// account. Instances are concurrency-safe, as long as URI and Key
+// are not modified. Requests share a pool of nonces.
 type ClientAccount struct {
 	// URI is the registration URI of the account.
 	URI    string
@@ -29,6 +29,8 @@ type ClientAccount struct {
 	dirURI string
 	http   getPoster
 
+	// mu protects the caches.
+	mu sync.Mutex
 	// d is a cache with URIs to well-known endpoints.
 	d *protocol.Directory
 	// reg is a cache used to get the authz and cert enumeration URIs.
@@ -41,24 +43,25 @@ type getPoster interface {
 }
 
 // NewClientAccount creates a new account client by supplying the
-// directory URI, account registration URI and the account key.
+// directory URI, account registration URI and the account key. The
+// key can be any crypto.Signer or jose.OpaqueSigner. To use another
+// JWS algorithm than the default for the key type, e.g. PS256 for
+// RSA, pass a jose.SigningKey.
 func NewClientAccount(dirURI, regURI string, accountKey crypto.PrivateKey) (*ClientAccount, error) {
-	type hasPublic interface {
-		Public() crypto.PublicKey
-	}
-	var pub crypto.PublicKey
-	if hp, ok := accountKey.(hasPublic); ok {
-		pub = hp.Public()
+	sk, pub, err := signingKey(accountKey)
+	if err != nil {
+		return nil, err
 	}
 
 	s, err := jose.NewSigner(
-		jose.SigningKey{Algorithm: signatureAlgo(accountKey), Key: accountKey},
-		&jose.SignerOptions{NonceSource: &protocol.NonceStack{}, EmbedJWK: true})
+		sk,
+		&jose.SignerOptions{NonceSource: protocol.NewNoncePool(0), EmbedJWK: true})
 	if err != nil {
 		return nil, err
 	}
 
 	hc := protocol.NewHTTPClient(nil, s)
+	hc.SetNonceURI(dirURI)
 	// Get an initial nonce and validate the URI.
 	if _, err := hc.Head(dirURI); err != nil {
 		return nil, err
@@ -188,15 +191,36 @@ func (a *ClientAccount) ValidateChallenge(uri string, req protocol.Response) (pr
 // authorized. This function will block until the requst is completed
 // by the ACME server.
 func (a *ClientAccount) IssueCertificate(csr []byte) (*Certificate, error) {
+	return a.issueCertificate(&protocol.CertificateIssuance{
+		Resource: protocol.ResourceNewCert,
+		CSR:      protocol.DERData(csr),
+	})
+}
+
+// ReplaceCertificate is like IssueCertificate, but tells the server
+// that the new certificate replaces the one with the given CertID,
+// e.g. so it is exempt from rate limits. See CertID. If the server
+// does not advertise renewal information, the CertID is not sent.
+func (a *ClientAccount) ReplaceCertificate(csr []byte, certID string) (*Certificate, error) {
+	return a.issueCertificate(&protocol.CertificateIssuance{
+		Resource: protocol.ResourceNewCert,
+		CSR:      protocol.DERData(csr),
+		Replaces: certID,
+	})
+}
+
+func (a *ClientAccount) issueCertificate(req *protocol.CertificateIssuance) (*Certificate, error) {
 	d, err := a.directory()
 	if err != nil {
 		return nil, err
 	}
+	if d.RenewalInfo == "" {
+		// RFC 9773: only send replaces to servers
+		// supporting ARI.
+		req.Replaces = ""
+	}
 
-	cbs, resp, err := protocol.PostCertificateIssuance(a.http, d.NewCert, &protocol.CertificateIssuance{
-		Resource: protocol.ResourceNewCert,
-		CSR:      protocol.DERData(csr),
-	})
+	cbs, resp, err := protocol.PostCertificateIssuance(a.http, d.NewCert, req)
 	if err != nil {
 		return nil, err
 	}
@@ -308,6 +332,9 @@ func (a *ClientAccount) RevokeCertificate(cert []byte) error {
 
 // directory returns the ACME server directory, and caches it.
 func (a *ClientAccount) directory() (*protocol.Directory, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
 	if a.d == nil {
 		d, _, err := protocol.GetDirectory(a.http, a.dirURI)
 		if err != nil {
@@ -321,6 +348,9 @@ func (a *ClientAccount) directory() (*protocol.Directory, error) {
 
 // registration returns the current ACME account registration, and caches it.
 func (a *ClientAccount) registration() (*protocol.Registration, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
 	if a.reg == nil {
 		reg, _, err := protocol.PostRegistration(a.http, a.URI, &protocol.Registration{
 			Resource: protocol.ResourceReg,
@@ -347,11 +377,20 @@ func contentLocation(r *http.Response) (*url.URL, error) {
 	return r.Request.URL.Parse(s)
 }
 
-// retryAfter returns the Retry-After header, or def.
+// retryAfter returns the Retry-After header, or def. The header can
+// be either seconds or an HTTP date.
 func retryAfter(hdr http.Header, def time.Duration) (time.Duration, error) {
-	n, err := strconv.Atoi(hdr.Get(protocol.RetryAfter))
+	s := hdr.Get(protocol.RetryAfter)
+	n, err := strconv.Atoi(s)
 	if err != nil {
-		return def, err
+		t, terr := http.ParseTime(s)
+		if terr != nil {
+			return def, err
+		}
+		if d := time.Until(t); d > 0 {
+			return d, nil
+		}
+		return 0, nil
 	}
 
 	return time.Duration(n) * time.Second, nil
@@ -382,26 +421,3 @@ func links(r *http.Response, rel string) []string {
 
 	return ret
 }
-
-// signatureAlgo returns a suggested JWS algorithm based on the
-// private key. Returns a zero value if none exists.
-func signatureAlgo(key crypto.PrivateKey) jose.SignatureAlgorithm {
-	switch k := key.(type) {
-	case *ecdsa.PrivateKey:
-		// This is a generalization of what the ECDH algorithm
-		// uses in the ACME spec.
-		if k.Curve.Params().BitSize < 256 {
-			return jose.ES256
-		} else if k.Curve.Params().BitSize < 521 {
-			return jose.ES384
-		} else {
-			return jose.ES512
-		}
-
-	case *rsa.PrivateKey:
-		// RS256 is the default in the letsencrypt client.
-		return jose.RS256
-	}
-
-	return ""
-}
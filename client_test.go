@@ -41,26 +41,47 @@ func TestClientAccountUpdateRegistration(t *testing.T) {
 }
 
 func TestClientAccountRegistration(t *testing.T) {
-	a, hc := newTestClientAccount()
-	hc.posters["/reg/1"] = func(accept string, reqBody, respBody interface{}) (*http.Response, error) {
-		req := reqBody.(*protocol.Registration)
+	tsts := []struct {
+		name   string
+		status int
 
-		if want := protocol.ResourceReg; req.Resource != want {
-			t.Errorf("Registration() Resource: got %v, want %v", req.Resource, want)
-		}
+		wantErr bool
+	}{
+		// Boulder.
+		{name: "accepted", status: http.StatusAccepted},
+		// Our HTTPServer.
+		{name: "ok", status: http.StatusOK},
+		{name: "no content", status: http.StatusNoContent, wantErr: true},
+	}
 
-		resp := respBody.(*protocol.Registration)
-		resp.ContactURIs = []string{"mailto:acme@example.com"}
+	for _, tst := range tsts {
+		a, hc := newTestClientAccount()
+		hc.posters["/reg/1"] = func(accept string, reqBody, respBody interface{}) (*http.Response, error) {
+			req := reqBody.(*protocol.Registration)
 
-		return &http.Response{StatusCode: http.StatusAccepted}, nil
-	}
+			if want := protocol.ResourceReg; req.Resource != want {
+				t.Errorf("[%s] Registration() Resource: got %v, want %v", tst.name, req.Resource, want)
+			}
 
-	reg, err := a.Registration()
-	if err != nil {
-		t.Fatalf("Registration() failed: %v", err)
-	}
-	if want := []string{"mailto:acme@example.com"}; !reflect.DeepEqual(reg.ContactURIs, want) {
-		t.Errorf("Registration() ContactURIs: got %v, want %v", reg.ContactURIs, want)
+			resp := respBody.(*protocol.Registration)
+			resp.ContactURIs = []string{"mailto:acme@example.com"}
+
+			return &http.Response{StatusCode: tst.status, Status: http.StatusText(tst.status)}, nil
+		}
+
+		reg, err := a.Registration()
+		if tst.wantErr {
+			if err == nil {
+				t.Errorf("[%s] Registration(): got success, want error", tst.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("[%s] Registration() failed: %v", tst.name, err)
+		}
+		if want := []string{"mailto:acme@example.com"}; !reflect.DeepEqual(reg.ContactURIs, want) {
+			t.Errorf("[%s] Registration() ContactURIs: got %v, want %v", tst.name, reg.ContactURIs, want)
+		}
 	}
 }
 
@@ -81,9 +81,10 @@ func doRegistration(hc protocol.Poster, uri string, req *protocol.Registration,
 	u, _ := resp.Location()
 
 	switch resp.StatusCode {
-	case http.StatusAccepted, http.StatusCreated:
+	case http.StatusOK, http.StatusAccepted, http.StatusCreated:
 		// TODO: Unspecified behavior.
-		// ResourceReg returns StatusAccepted in Boulder.
+		// ResourceReg returns StatusAccepted in Boulder, and
+		// StatusOK in our HTTPServer.
 		break
 
 	default:
@@ -3,6 +3,7 @@ package acme
 import (
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/tommie/acme-go/protocol"
@@ -26,3 +27,28 @@ func TestClientAccountRegisterAccount(t *testing.T) {
 		t.Errorf("RegisterAccount(WithContactURIs) a.URI: got %v, want suffix %v", a.URI, want)
 	}
 }
+
+func TestClientAccountConcurrent(t *testing.T) {
+	_, hts := newFakeACMEServer()
+	defer hts.Close()
+
+	a, _, err := RegisterAccount(hts.URL+protocol.DirectoryPath, testJWK.Key)
+	if err != nil {
+		t.Fatalf("RegisterAccount failed: %v", err)
+	}
+
+	// The fake server rejects all authorizations, but only after
+	// checking the nonce.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := a.AuthorizeIdentity(DNSIdentifier("example.com"))
+			if want := "mock error detail"; err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("AuthorizeIdentity: got %v, want containing %q", err, want)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,131 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"net"
+)
+
+var (
+	ErrAccountKeyReuse = errors.New("certificate key is the account key")
+	ErrNoIdentifiers   = errors.New("no identifiers")
+)
+
+// idPETLSFeature is the X.509 TLS Feature extension. RFC 7633.
+var idPETLSFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// tlsFeatureStatusRequest is the status_request TLS extension, which
+// requires OCSP stapling when listed in the TLS Feature extension.
+const tlsFeatureStatusRequest = 5
+
+// maxCommonNameLength is the upper bound of the X.509 common name.
+// RFC 5280 Appendix A.1.
+const maxCommonNameLength = 64
+
+type csrConfig struct {
+	mustStaple bool
+	accountKey crypto.PublicKey
+}
+
+// A CSROpt is an option for NewCSR.
+type CSROpt func(*csrConfig)
+
+// WithMustStaple adds the TLS Feature extension requesting OCSP
+// must-staple.
+func WithMustStaple() CSROpt {
+	return func(c *csrConfig) {
+		c.mustStaple = true
+	}
+}
+
+// WithAccountKeyCheck makes NewCSR fail with ErrAccountKeyReuse if
+// the certificate key is the given account key.
+func WithAccountKeyCheck(accountKey crypto.PublicKey) CSROpt {
+	return func(c *csrConfig) {
+		c.accountKey = accountKey
+	}
+}
+
+// IdentifiersFromNames returns identifiers for host names and IP
+// addresses. Names that parse as IP addresses become IPIdentifiers.
+func IdentifiersFromNames(names ...string) []Identifier {
+	ids := make([]Identifier, 0, len(names))
+	for _, n := range names {
+		if ip := net.ParseIP(n); ip != nil {
+			ids = append(ids, IPIdentifier(ip.String()))
+		} else {
+			ids = append(ids, DNSIdentifier(n))
+		}
+	}
+	return ids
+}
+
+// NewCSR creates a DER-encoded certificate signing request for the
+// identifiers, signed by key. The first DNS identifier short enough
+// becomes the common name.
+func NewCSR(ids []Identifier, key crypto.Signer, opts ...CSROpt) ([]byte, error) {
+	var cfg csrConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if len(ids) == 0 {
+		return nil, ErrNoIdentifiers
+	}
+	if cfg.accountKey != nil && publicKeysEqual(key.Public(), cfg.accountKey) {
+		return nil, ErrAccountKeyReuse
+	}
+
+	req := &x509.CertificateRequest{}
+	for _, id := range ids {
+		switch id := id.(type) {
+		case DNSIdentifier:
+			if req.Subject.CommonName == "" && len(id) <= maxCommonNameLength {
+				req.Subject = pkix.Name{CommonName: string(id)}
+			}
+			req.DNSNames = append(req.DNSNames, string(id))
+
+		case IPIdentifier:
+			ip := net.ParseIP(string(id))
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", string(id))
+			}
+			req.IPAddresses = append(req.IPAddresses, ip)
+
+		default:
+			return nil, fmt.Errorf("unsupported identifier in CSR: %v", id)
+		}
+	}
+
+	if cfg.mustStaple {
+		v, err := asn1.Marshal([]int{tlsFeatureStatusRequest})
+		if err != nil {
+			return nil, err
+		}
+		req.ExtraExtensions = append(req.ExtraExtensions, pkix.Extension{Id: idPETLSFeature, Value: v})
+	}
+
+	return x509.CreateCertificateRequest(rand.Reader, req, key)
+}
+
+// AuthorizeAndIssueIdentifiers is like AuthorizeAndIssue, but creates
+// the CSR from identifiers and the certificate key. If the issuing
+// account is a *ClientAccount, the key is checked not to be the
+// account key.
+func (ci *CertificateIssuer) AuthorizeAndIssueIdentifiers(ids []Identifier, key crypto.Signer, s Solver, opts ...CSROpt) (*Certificate, error) {
+	if a, ok := ci.ia.(*ClientAccount); ok && a.Key != nil {
+		opts = append([]CSROpt{WithAccountKeyCheck(a.Key)}, opts...)
+	}
+
+	csr, err := NewCSR(ids, key, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ci.AuthorizeAndIssue(csr, s)
+}
@@ -0,0 +1,112 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/tommie/acme-go/protocol"
+)
+
+func TestNewCSR(t *testing.T) {
+	key := mustGenerateECDSAKey()
+	ids := IdentifiersFromNames("example.com", "192.0.2.1", "www.example.com", "2001:db8::1")
+
+	bs, err := NewCSR(ids, key, WithMustStaple(), WithAccountKeyCheck(mustGenerateECDSAKey().Public()))
+	if err != nil {
+		t.Fatalf("NewCSR failed: %v", err)
+	}
+	csr, err := x509.ParseCertificateRequest(bs)
+	if err != nil {
+		t.Fatalf("ParseCertificateRequest failed: %v", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Errorf("CheckSignature failed: %v", err)
+	}
+
+	if want := "example.com"; csr.Subject.CommonName != want {
+		t.Errorf("NewCSR CommonName: got %q, want %q", csr.Subject.CommonName, want)
+	}
+	if want := []string{"example.com", "www.example.com"}; !reflect.DeepEqual(csr.DNSNames, want) {
+		t.Errorf("NewCSR DNSNames: got %v, want %v", csr.DNSNames, want)
+	}
+	var ips []string
+	for _, ip := range csr.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	if want := []string{"192.0.2.1", "2001:db8::1"}; !reflect.DeepEqual(ips, want) {
+		t.Errorf("NewCSR IPAddresses: got %v, want %v", ips, want)
+	}
+
+	var features []int
+	for _, ext := range csr.Extensions {
+		if ext.Id.Equal(idPETLSFeature) {
+			if _, err := asn1.Unmarshal(ext.Value, &features); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+		}
+	}
+	if want := []int{5}; !reflect.DeepEqual(features, want) {
+		t.Errorf("NewCSR TLS features: got %v, want %v", features, want)
+	}
+
+	if got, want := csrIdentifiers(csr), IdentifiersFromNames("example.com", "www.example.com", "192.0.2.1", "2001:db8::1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("csrIdentifiers: got %v, want %v", got, want)
+	}
+}
+
+func TestNewCSRErrors(t *testing.T) {
+	key := mustGenerateECDSAKey()
+
+	tsts := []struct {
+		name string
+		ids  []Identifier
+		opts []CSROpt
+
+		err error
+	}{
+		{name: "noIDs", err: ErrNoIdentifiers},
+		{name: "accountKey", ids: IdentifiersFromNames("example.com"), opts: []CSROpt{WithAccountKeyCheck(key.Public())}, err: ErrAccountKeyReuse},
+		{name: "badIP", ids: []Identifier{IPIdentifier("example.com")}, err: fmt.Errorf("invalid IP address")},
+	}
+	for _, tst := range tsts {
+		_, err := NewCSR(tst.ids, key, tst.opts...)
+		if !matchError(err, tst.err) {
+			t.Errorf("[%s] NewCSR: got %v, want prefix %v", tst.name, err, tst.err)
+		}
+	}
+}
+
+func TestCertificateIssuerAuthorizeAndIssueIdentifiers(t *testing.T) {
+	var ids []string
+	ia := &stubIssuingAccount{
+		authzID: func(id Identifier) (*Authorization, error) {
+			ids = append(ids, id.String())
+			return &Authorization{Status: protocol.StatusValid}, nil
+		},
+		issue: func(csr []byte) (*Certificate, error) {
+			return &Certificate{URI: "http://example.com/cert/4"}, nil
+		},
+	}
+
+	_, err := NewCertificateIssuer(ia).AuthorizeAndIssueIdentifiers(IdentifiersFromNames("example.com", "192.0.2.1"), mustGenerateECDSAKey(), &stubSolver{})
+	if err != nil {
+		t.Fatalf("AuthorizeAndIssueIdentifiers failed: %v", err)
+	}
+	if want := []string{"dns:example.com", "ip:192.0.2.1"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("AuthorizeAndIssueIdentifiers ids: got %v, want %v", ids, want)
+	}
+}
+
+func mustGenerateECDSAKey() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
@@ -0,0 +1,158 @@
+package dns01
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// fakeDNSServer is an in-process DNS server answering from a set of
+// records. It acts both as a recursive resolver and as an
+// authoritative server, which is enough for tests. If started with
+// TSIG keys, it also accepts signed dynamic updates.
+type fakeDNSServer struct {
+	Addr string
+
+	tsig map[string]string
+
+	mu  sync.Mutex
+	rrs map[string][]dns.RR
+}
+
+// newFakeDNSServer starts a server on a random UDP port on
+// 127.0.0.1. The server is shut down when the test finishes.
+func newFakeDNSServer(t *testing.T, rrs ...string) *fakeDNSServer {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+
+	return startFakeDNSServer(t, pc, rrs...)
+}
+
+// startFakeDNSServer starts a server on the given connection.
+func startFakeDNSServer(t *testing.T, pc net.PacketConn, rrs ...string) *fakeDNSServer {
+	return startFakeDNSUpdateServer(t, pc, nil, rrs...)
+}
+
+// startFakeDNSUpdateServer is like startFakeDNSServer, but also
+// accepts dynamic updates. tsig maps key names to secrets accepted
+// for updates.
+func startFakeDNSUpdateServer(t *testing.T, pc net.PacketConn, tsig map[string]string, rrs ...string) *fakeDNSServer {
+	s := &fakeDNSServer{
+		Addr: pc.LocalAddr().String(),
+		rrs:  map[string][]dns.RR{},
+		tsig: tsig,
+	}
+	for _, rr := range rrs {
+		s.add(t, rr)
+	}
+
+	started := make(chan struct{})
+	srv := &dns.Server{
+		PacketConn:        pc,
+		Handler:           s,
+		TsigSecret:        tsig,
+		MsgAcceptFunc:     acceptAll,
+		NotifyStartedFunc: func() { close(started) },
+	}
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+
+	return s
+}
+
+// acceptAll is a dns.MsgAcceptFunc accepting all messages. The
+// default rejects UPDATE.
+func acceptAll(dns.Header) dns.MsgAcceptAction {
+	return dns.MsgAccept
+}
+
+// add adds a record in zone file format.
+func (s *fakeDNSServer) add(t *testing.T, rr string) {
+	r, err := dns.NewRR(rr)
+	if err != nil {
+		t.Fatalf("NewRR(%q) failed: %v", rr, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := strings.ToLower(r.Header().Name)
+	s.rrs[n] = append(s.rrs[n], r)
+}
+
+// txt returns the TXT values for a name.
+func (s *fakeDNSServer) txt(name string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ret []string
+	for _, rr := range s.rrs[strings.ToLower(name)] {
+		if txt, ok := rr.(*dns.TXT); ok {
+			ret = append(ret, txt.Txt...)
+		}
+	}
+	return ret
+}
+
+func (s *fakeDNSServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := &dns.Msg{}
+	m.SetReply(req)
+	if req.Opcode == dns.OpcodeUpdate {
+		s.serveUpdate(w, req, m)
+		return
+	}
+	q := req.Question[0]
+	rrs, ok := s.rrs[strings.ToLower(q.Name)]
+	if !ok {
+		m.Rcode = dns.RcodeNameError
+	}
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == q.Qtype || rr.Header().Rrtype == dns.TypeCNAME {
+			m.Answer = append(m.Answer, rr)
+		}
+	}
+	w.WriteMsg(m)
+}
+
+// serveUpdate applies the update section of an RFC 2136 UPDATE
+// message. Prerequisites are ignored. Called with mu held.
+func (s *fakeDNSServer) serveUpdate(w dns.ResponseWriter, req *dns.Msg, m *dns.Msg) {
+	tsig := req.IsTsig()
+	if tsig == nil || w.TsigStatus() != nil {
+		m.Rcode = dns.RcodeRefused
+		w.WriteMsg(m)
+		return
+	}
+
+	for _, rr := range req.Ns {
+		n := strings.ToLower(rr.Header().Name)
+		switch rr.Header().Class {
+		case dns.ClassINET:
+			s.rrs[n] = append(s.rrs[n], rr)
+
+		case dns.ClassNONE:
+			var keep []dns.RR
+			for _, orr := range s.rrs[n] {
+				del := dns.Copy(orr)
+				del.Header().Class = dns.ClassNONE
+				if !dns.IsDuplicate(del, rr) {
+					keep = append(keep, orr)
+				}
+			}
+			s.rrs[n] = keep
+		}
+	}
+
+	m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsigFudge, time.Now().Unix())
+	w.WriteMsg(m)
+}
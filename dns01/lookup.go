@@ -0,0 +1,79 @@
+package dns01
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// maxCNAMEHops is the maximum length of a CNAME chain we follow.
+	maxCNAMEHops = 16
+
+	defaultResolvConf = "/etc/resolv.conf"
+)
+
+// systemResolver returns the first nameserver in /etc/resolv.conf.
+func systemResolver() (string, error) {
+	cc, err := dns.ClientConfigFromFile(defaultResolvConf)
+	if err != nil {
+		return "", err
+	}
+	if len(cc.Servers) == 0 {
+		return "", fmt.Errorf("no nameservers in %s", defaultResolvConf)
+	}
+	return net.JoinHostPort(cc.Servers[0], cc.Port), nil
+}
+
+// followCNAMEs returns the final target of a CNAME chain starting
+// at name. If name is not a CNAME, it is returned as-is.
+func followCNAMEs(client *dns.Client, resolver, name string) (string, error) {
+	for i := 0; i < maxCNAMEHops; i++ {
+		r, err := exchange(client, resolver, name, dns.TypeCNAME, true)
+		if err != nil {
+			return "", err
+		}
+		if r.Rcode != dns.RcodeSuccess && r.Rcode != dns.RcodeNameError {
+			return "", fmt.Errorf("CNAME lookup of %s failed: %s", name, dns.RcodeToString[r.Rcode])
+		}
+
+		next := ""
+		for _, rr := range r.Answer {
+			if cn, ok := rr.(*dns.CNAME); ok && strings.EqualFold(cn.Hdr.Name, name) {
+				next = cn.Target
+				break
+			}
+		}
+		if next == "" {
+			return name, nil
+		}
+		name = next
+	}
+
+	return "", fmt.Errorf("CNAME chain too long at %s", name)
+}
+
+// exchange sends a single query, retrying over TCP if the UDP
+// response was truncated.
+func exchange(client *dns.Client, server, name string, typ uint16, recurse bool) (*dns.Msg, error) {
+	m := &dns.Msg{}
+	m.SetQuestion(name, typ)
+	m.RecursionDesired = recurse
+
+	r, _, err := client.Exchange(m, server)
+	if err != nil {
+		return nil, err
+	}
+	if r.Truncated {
+		tc := *client
+		tc.Net = "tcp"
+		r, _, err = tc.Exchange(m, server)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
@@ -0,0 +1,240 @@
+// Package dns01 provides building blocks for solving dns-01
+// challenges.
+package dns01
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/tommie/acme-go"
+)
+
+var (
+	ErrNotPropagated = errors.New("TXT record not propagated")
+	ErrTimeout       = errors.New("timed out waiting for propagation")
+)
+
+// A PropagationChecker verifies that a TXT record is visible on all
+// authoritative nameservers of the zone it belongs to. The ACME
+// server may query any of them, so it is not enough to look at a
+// recursive resolver. Instances are concurrency-safe.
+type PropagationChecker struct {
+	resolver string
+	nsPort   string
+	timeout  time.Duration
+	interval time.Duration
+	client   *dns.Client
+}
+
+// A CheckerOpt is an option for NewPropagationChecker.
+type CheckerOpt func(*PropagationChecker)
+
+// WithResolver sets the address (host:port) of the recursive resolver
+// used to look up CNAMEs, zone cuts and nameserver addresses. The
+// default is the first nameserver in /etc/resolv.conf.
+func WithResolver(addr string) CheckerOpt {
+	return func(c *PropagationChecker) {
+		c.resolver = addr
+	}
+}
+
+// WithNameserverPort sets the port used when querying authoritative
+// nameservers. The default is 53.
+func WithNameserverPort(port string) CheckerOpt {
+	return func(c *PropagationChecker) {
+		c.nsPort = port
+	}
+}
+
+// WithTimeout sets the maximum time Wait polls for. The default is
+// two minutes.
+func WithTimeout(d time.Duration) CheckerOpt {
+	return func(c *PropagationChecker) {
+		c.timeout = d
+	}
+}
+
+// WithPollInterval sets the time between checks in Wait. The default
+// is two seconds.
+func WithPollInterval(d time.Duration) CheckerOpt {
+	return func(c *PropagationChecker) {
+		c.interval = d
+	}
+}
+
+// NewPropagationChecker creates a new checker with the given options.
+func NewPropagationChecker(opts ...CheckerOpt) *PropagationChecker {
+	c := &PropagationChecker{
+		nsPort:   "53",
+		timeout:  2 * time.Minute,
+		interval: 2 * time.Second,
+		client:   &dns.Client{Timeout: 5 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Wait polls Check until the record is visible everywhere, the
+// timeout expires, or cancel is closed. On timeout, the returned
+// error wraps ErrTimeout and describes the last failure. If
+// canceled, it returns acme.ErrCanceled. A nil cancel is never
+// closed.
+func (c *PropagationChecker) Wait(fqdn, value string, cancel <-chan struct{}) error {
+	deadline := time.Now().Add(c.timeout)
+	for {
+		err := c.Check(fqdn, value)
+		if err == nil {
+			return nil
+		}
+		if !time.Now().Add(c.interval).Before(deadline) {
+			return fmt.Errorf("%w: %v", ErrTimeout, err)
+		}
+
+		t := time.NewTimer(c.interval)
+		select {
+		case <-t.C:
+		case <-cancel:
+			t.Stop()
+			return acme.ErrCanceled
+		}
+	}
+}
+
+// Check verifies once that every authoritative nameserver of the
+// zone returns a TXT record with the given value for fqdn. CNAMEs
+// are followed, and the record is looked up at the final target.
+// Returns an error wrapping ErrNotPropagated if any server lacks the
+// record.
+func (c *PropagationChecker) Check(fqdn, value string) error {
+	resolver, err := c.resolverAddr()
+	if err != nil {
+		return err
+	}
+
+	target, err := followCNAMEs(c.client, resolver, dns.Fqdn(fqdn))
+	if err != nil {
+		return err
+	}
+
+	zone, nss, err := c.findZone(resolver, target)
+	if err != nil {
+		return err
+	}
+
+	var naddrs int
+	for _, ns := range nss {
+		addrs, err := c.lookupAddrs(resolver, ns)
+		if err != nil {
+			return err
+		}
+		for _, addr := range addrs {
+			naddrs++
+			vals, err := c.lookupTXT(net.JoinHostPort(addr, c.nsPort), target)
+			if err != nil {
+				return fmt.Errorf("%w: %s at %s (%s): %v", ErrNotPropagated, target, ns, addr, err)
+			}
+			if !containsString(vals, value) {
+				return fmt.Errorf("%w: %s at %s (%s) has %q", ErrNotPropagated, target, ns, addr, vals)
+			}
+		}
+	}
+	if naddrs == 0 {
+		return fmt.Errorf("no nameserver addresses found for zone %s", zone)
+	}
+
+	return nil
+}
+
+// resolverAddr returns the configured resolver, or the system default.
+func (c *PropagationChecker) resolverAddr() (string, error) {
+	if c.resolver != "" {
+		return c.resolver, nil
+	}
+	return systemResolver()
+}
+
+// findZone walks up from name until it finds a name with NS
+// records. Returns the zone name and the nameserver host names.
+func (c *PropagationChecker) findZone(resolver, name string) (string, []string, error) {
+	labels := dns.SplitDomainName(name)
+	for i := range labels {
+		zone := dns.Fqdn(strings.Join(labels[i:], "."))
+		r, err := exchange(c.client, resolver, zone, dns.TypeNS, true)
+		if err != nil {
+			return "", nil, err
+		}
+		if r.Rcode != dns.RcodeSuccess {
+			continue
+		}
+
+		var nss []string
+		for _, rr := range r.Answer {
+			if ns, ok := rr.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, zone) {
+				nss = append(nss, ns.Ns)
+			}
+		}
+		if len(nss) > 0 {
+			return zone, nss, nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("no zone with NS records found for %s", name)
+}
+
+// lookupAddrs resolves the IPv4 and IPv6 addresses of a host.
+func (c *PropagationChecker) lookupAddrs(resolver, host string) ([]string, error) {
+	var ret []string
+	for _, typ := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		r, err := exchange(c.client, resolver, host, typ, true)
+		if err != nil {
+			return nil, err
+		}
+		for _, rr := range r.Answer {
+			switch rr := rr.(type) {
+			case *dns.A:
+				ret = append(ret, rr.A.String())
+			case *dns.AAAA:
+				ret = append(ret, rr.AAAA.String())
+			}
+		}
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no addresses found for nameserver %s", host)
+	}
+
+	return ret, nil
+}
+
+// lookupTXT queries an authoritative server directly for TXT values.
+func (c *PropagationChecker) lookupTXT(server, name string) ([]string, error) {
+	r, err := exchange(c.client, server, name, dns.TypeTXT, false)
+	if err != nil {
+		return nil, err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("TXT lookup failed: %s", dns.RcodeToString[r.Rcode])
+	}
+
+	var ret []string
+	for _, rr := range r.Answer {
+		if txt, ok := rr.(*dns.TXT); ok && strings.EqualFold(txt.Hdr.Name, name) {
+			ret = append(ret, strings.Join(txt.Txt, ""))
+		}
+	}
+	return ret, nil
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package dns01
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tommie/acme-go"
+)
+
+func TestPropagationCheckerCheck(t *testing.T) {
+	tsts := []struct {
+		name string
+		rrs  []string
+		fqdn string
+
+		err error
+	}{
+		{
+			name: "propagated",
+			rrs: []string{
+				`_acme-challenge.example.com. 60 IN TXT "value"`,
+			},
+			fqdn: "_acme-challenge.example.com",
+		},
+		{
+			name: "missing",
+			fqdn: "_acme-challenge.example.com",
+
+			err: ErrNotPropagated,
+		},
+		{
+			name: "wrong value",
+			rrs: []string{
+				`_acme-challenge.example.com. 60 IN TXT "other"`,
+			},
+			fqdn: "_acme-challenge.example.com.",
+
+			err: ErrNotPropagated,
+		},
+		{
+			name: "cname",
+			rrs: []string{
+				`_acme-challenge.example.com. 60 IN CNAME a.validation.example.net.`,
+				`a.validation.example.net. 60 IN CNAME b.validation.example.net.`,
+				`validation.example.net. 60 IN NS ns1.example.com.`,
+				`b.validation.example.net. 60 IN TXT "value"`,
+			},
+			fqdn: "_acme-challenge.example.com",
+		},
+	}
+
+	for _, tst := range tsts {
+		s := newFakeDNSServer(t, append([]string{
+			`example.com. 60 IN NS ns1.example.com.`,
+			`ns1.example.com. 60 IN A 127.0.0.1`,
+		}, tst.rrs...)...)
+		_, port, _ := net.SplitHostPort(s.Addr)
+		c := NewPropagationChecker(WithResolver(s.Addr), WithNameserverPort(port))
+
+		err := c.Check(tst.fqdn, "value")
+		if !errors.Is(err, tst.err) {
+			t.Errorf("[%s] Check: got %v, want %v", tst.name, err, tst.err)
+		}
+	}
+}
+
+func TestPropagationCheckerCheckAllNameservers(t *testing.T) {
+	primary := newFakeDNSServer(t,
+		`example.com. 60 IN NS ns1.example.com.`,
+		`example.com. 60 IN NS ns2.example.com.`,
+		`ns1.example.com. 60 IN A 127.0.0.1`,
+		`ns2.example.com. 60 IN A 127.0.0.2`,
+		`_acme-challenge.example.com. 60 IN TXT "value"`)
+	_, port, _ := net.SplitHostPort(primary.Addr)
+
+	// The secondary has not received the record yet.
+	pc, err := net.ListenPacket("udp", net.JoinHostPort("127.0.0.2", port))
+	if err != nil {
+		t.Skipf("ListenPacket failed: %v", err)
+	}
+	secondary := startFakeDNSServer(t, pc)
+
+	c := NewPropagationChecker(WithResolver(primary.Addr), WithNameserverPort(port))
+	if err := c.Check("_acme-challenge.example.com", "value"); !errors.Is(err, ErrNotPropagated) {
+		t.Errorf("Check: got %v, want %v", err, ErrNotPropagated)
+	}
+
+	secondary.add(t, `_acme-challenge.example.com. 60 IN TXT "value"`)
+	if err := c.Check("_acme-challenge.example.com", "value"); err != nil {
+		t.Errorf("Check failed: %v", err)
+	}
+}
+
+func TestPropagationCheckerWait(t *testing.T) {
+	s := newFakeDNSServer(t,
+		`example.com. 60 IN NS ns1.example.com.`,
+		`ns1.example.com. 60 IN A 127.0.0.1`)
+	_, port, _ := net.SplitHostPort(s.Addr)
+	c := NewPropagationChecker(
+		WithResolver(s.Addr),
+		WithNameserverPort(port),
+		WithTimeout(time.Second),
+		WithPollInterval(10*time.Millisecond))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		s.add(t, `_acme-challenge.example.com. 60 IN TXT "value"`)
+	}()
+	if err := c.Wait("_acme-challenge.example.com", "value", nil); err != nil {
+		t.Errorf("Wait failed: %v", err)
+	}
+
+	if err := c.Wait("_acme-challenge.example.com", "other", nil); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Wait: got %v, want %v", err, ErrTimeout)
+	}
+
+	cancel := make(chan struct{})
+	close(cancel)
+	if err := c.Wait("_acme-challenge.example.com", "other", cancel); err != acme.ErrCanceled {
+		t.Errorf("Wait (canceled): got %v, want %v", err, acme.ErrCanceled)
+	}
+}
@@ -0,0 +1,125 @@
+package dns01
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// tsigFudge is the allowed clock skew for TSIG signatures, in seconds.
+const tsigFudge = 300
+
+// An RFC2136Provider is a DNSProvider sending dynamic DNS updates
+// (RFC 2136) to a primary nameserver, authenticated with TSIG using
+// HMAC-SHA256. BIND and Knot accept these.
+type RFC2136Provider struct {
+	server  string
+	keyName string
+	zone    string
+	ttl     uint32
+	client  *dns.Client
+}
+
+// An RFC2136Opt is an option for NewRFC2136Provider.
+type RFC2136Opt func(*RFC2136Provider)
+
+// WithZone sets the zone to update. By default, the zone is found by
+// asking the server for the SOA record of the name being updated.
+func WithZone(zone string) RFC2136Opt {
+	return func(p *RFC2136Provider) {
+		p.zone = dns.Fqdn(zone)
+	}
+}
+
+// WithTTL sets the TTL of added records. The default is one minute.
+func WithTTL(ttl time.Duration) RFC2136Opt {
+	return func(p *RFC2136Provider) {
+		p.ttl = uint32(ttl / time.Second)
+	}
+}
+
+// NewRFC2136Provider creates a provider sending updates to the given
+// server (host:port). keyName is the TSIG key name and secret is the
+// base64-encoded HMAC-SHA256 secret.
+func NewRFC2136Provider(server, keyName, secret string, opts ...RFC2136Opt) *RFC2136Provider {
+	keyName = strings.ToLower(dns.Fqdn(keyName))
+	p := &RFC2136Provider{
+		server:  server,
+		keyName: keyName,
+		ttl:     60,
+		client: &dns.Client{
+			Timeout:    10 * time.Second,
+			TsigSecret: map[string]string{keyName: secret},
+		},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func (p *RFC2136Provider) AddTXTRecord(fqdn, value string) error {
+	return p.update(fqdn, value, (*dns.Msg).Insert)
+}
+
+func (p *RFC2136Provider) RemoveTXTRecord(fqdn, value string) error {
+	return p.update(fqdn, value, (*dns.Msg).Remove)
+}
+
+// update sends an UPDATE message for a single TXT record. op is
+// either Insert or Remove.
+func (p *RFC2136Provider) update(fqdn, value string, op func(*dns.Msg, []dns.RR)) error {
+	fqdn = dns.Fqdn(fqdn)
+	zone, err := p.findZone(fqdn)
+	if err != nil {
+		return err
+	}
+
+	rr := &dns.TXT{
+		Hdr: dns.RR_Header{Name: fqdn, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: p.ttl},
+		Txt: []string{value},
+	}
+	m := &dns.Msg{}
+	m.SetUpdate(zone)
+	op(m, []dns.RR{rr})
+	m.SetTsig(p.keyName, dns.HmacSHA256, tsigFudge, time.Now().Unix())
+
+	r, _, err := p.client.Exchange(m, p.server)
+	if err != nil {
+		return err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("DNS update of %s in zone %s failed: %s", fqdn, zone, dns.RcodeToString[r.Rcode])
+	}
+
+	return nil
+}
+
+// findZone returns the configured zone, or asks the server for the
+// closest enclosing SOA record.
+func (p *RFC2136Provider) findZone(fqdn string) (string, error) {
+	if p.zone != "" {
+		return p.zone, nil
+	}
+
+	labels := dns.SplitDomainName(fqdn)
+	for i := range labels {
+		name := dns.Fqdn(strings.Join(labels[i:], "."))
+		m := &dns.Msg{}
+		m.SetQuestion(name, dns.TypeSOA)
+		r, _, err := p.client.Exchange(m, p.server)
+		if err != nil {
+			return "", err
+		}
+
+		for _, rr := range append(r.Answer, r.Ns...) {
+			if soa, ok := rr.(*dns.SOA); ok {
+				return soa.Hdr.Name, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no SOA record found for %s at %s", fqdn, p.server)
+}
@@ -0,0 +1,71 @@
+package dns01
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testTSIGKeyName = "acme-key."
+	// testTSIGSecret is a base64-encoded HMAC-SHA256 secret.
+	testTSIGSecret = "c2VjcmV0IGtleSB1c2VkIGZvciB0ZXN0aW5nIG9ubHk="
+)
+
+// newFakeDNSUpdateServer starts a server accepting updates signed
+// with testTSIGSecret.
+func newFakeDNSUpdateServer(t *testing.T, rrs ...string) *fakeDNSServer {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+
+	return startFakeDNSUpdateServer(t, pc, map[string]string{testTSIGKeyName: testTSIGSecret}, rrs...)
+}
+
+func TestRFC2136ProviderAddRemove(t *testing.T) {
+	s := newFakeDNSUpdateServer(t,
+		`example.com. 60 IN SOA ns1.example.com. hostmaster.example.com. 1 3600 600 86400 60`,
+		`_acme-challenge.example.com. 60 IN TXT "existing"`)
+	p := NewRFC2136Provider(s.Addr, "acme-key", testTSIGSecret)
+
+	if err := p.AddTXTRecord("_acme-challenge.example.com.", "value"); err != nil {
+		t.Fatalf("AddTXTRecord failed: %v", err)
+	}
+	if want := []string{"existing", "value"}; !reflect.DeepEqual(s.txt("_acme-challenge.example.com."), want) {
+		t.Errorf("AddTXTRecord TXT: got %q, want %q", s.txt("_acme-challenge.example.com."), want)
+	}
+
+	if err := p.RemoveTXTRecord("_acme-challenge.example.com", "value"); err != nil {
+		t.Fatalf("RemoveTXTRecord failed: %v", err)
+	}
+	if want := []string{"existing"}; !reflect.DeepEqual(s.txt("_acme-challenge.example.com."), want) {
+		t.Errorf("RemoveTXTRecord TXT: got %q, want %q", s.txt("_acme-challenge.example.com."), want)
+	}
+}
+
+func TestRFC2136ProviderWithZone(t *testing.T) {
+	s := newFakeDNSUpdateServer(t)
+	p := NewRFC2136Provider(s.Addr, testTSIGKeyName, testTSIGSecret, WithZone("example.com"))
+
+	if err := p.AddTXTRecord("_acme-challenge.www.example.com.", "value"); err != nil {
+		t.Fatalf("AddTXTRecord failed: %v", err)
+	}
+	if want := []string{"value"}; !reflect.DeepEqual(s.txt("_acme-challenge.www.example.com."), want) {
+		t.Errorf("AddTXTRecord TXT: got %q, want %q", s.txt("_acme-challenge.www.example.com."), want)
+	}
+}
+
+func TestRFC2136ProviderBadKey(t *testing.T) {
+	s := newFakeDNSUpdateServer(t)
+	p := NewRFC2136Provider(s.Addr, testTSIGKeyName, "d3Jvbmcgc2VjcmV0", WithZone("example.com"))
+
+	err := p.AddTXTRecord("_acme-challenge.example.com.", "value")
+	if err == nil || !strings.Contains(err.Error(), "REFUSED") {
+		t.Errorf("AddTXTRecord: got %v, want REFUSED", err)
+	}
+	if got := s.txt("_acme-challenge.example.com."); len(got) != 0 {
+		t.Errorf("AddTXTRecord TXT: got %q, want none", got)
+	}
+}
@@ -0,0 +1,294 @@
+package dns01
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/tommie/acme-go"
+	"github.com/tommie/acme-go/protocol"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// A DNSProvider can publish TXT records in some DNS service. Its
+// functions must be concurrency-safe.
+type DNSProvider interface {
+	// AddTXTRecord adds a TXT record with the given value. Other
+	// records with the same name must be left in place, since
+	// several challenges for the same name may be pending.
+	AddTXTRecord(fqdn, value string) error
+
+	// RemoveTXTRecord removes a TXT record previously added with
+	// AddTXTRecord.
+	RemoveTXTRecord(fqdn, value string) error
+}
+
+// A Solver is an acme.Solver for dns-01 challenges. It publishes the
+// validation TXT records through a DNSProvider and optionally waits
+// for them to propagate before returning from SolveIdentifiers.
+//
+// The _acme-challenge name can be delegated to another zone (often a
+// dedicated validation zone, as done by acme-dns) with a CNAME
+// record. With WithCNAMEDelegation or WithDelegations, the record is
+// published at the delegation target, so the provider only needs
+// access to that zone.
+type Solver struct {
+	key     *jose.JSONWebKey
+	p       DNSProvider
+	checker *PropagationChecker
+	cost    float64
+
+	// delegate is true if CNAMEs should be followed.
+	delegate    bool
+	resolver    string
+	delegations map[string]string
+	client      *dns.Client
+}
+
+// A SolverOpt is an option for NewSolver.
+type SolverOpt func(*Solver)
+
+// WithPropagationChecker makes SolveIdentifiers wait until the
+// records are visible on all authoritative nameservers. The records
+// are checked concurrently.
+func WithPropagationChecker(c *PropagationChecker) SolverOpt {
+	return func(s *Solver) {
+		s.checker = c
+	}
+}
+
+// WithCost sets the cost of solving a single challenge. The default
+// is 1.
+func WithCost(cost float64) SolverOpt {
+	return func(s *Solver) {
+		s.cost = cost
+	}
+}
+
+// WithCNAMEDelegation makes the solver follow a CNAME chain at the
+// _acme-challenge name and publish the record at the final
+// target. resolver is the address (host:port) of a recursive
+// resolver. If empty, the first nameserver in /etc/resolv.conf is
+// used.
+func WithCNAMEDelegation(resolver string) SolverOpt {
+	return func(s *Solver) {
+		s.delegate = true
+		s.resolver = resolver
+	}
+}
+
+// WithDelegations sets static delegation targets, used where CNAME
+// resolution is not possible. Keys are _acme-challenge names and
+// values are the names where the records are published instead. The
+// map takes precedence over WithCNAMEDelegation.
+func WithDelegations(m map[string]string) SolverOpt {
+	return func(s *Solver) {
+		s.delegations = map[string]string{}
+		for k, v := range m {
+			s.delegations[canonicalName(k)] = dns.Fqdn(v)
+		}
+	}
+}
+
+// NewSolver creates a new dns-01 solver. The key is the account key,
+// used to create key authorizations.
+func NewSolver(key *jose.JSONWebKey, p DNSProvider, opts ...SolverOpt) *Solver {
+	s := &Solver{
+		key:    key,
+		p:      p,
+		cost:   1,
+		client: &dns.Client{Timeout: 5 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *Solver) Cost(cs []protocol.Challenge) (float64, error) {
+	for _, c := range cs {
+		if _, ok := c.(*protocol.DNS01Challenge); !ok {
+			return 0, acme.ErrUnsolvable
+		}
+	}
+
+	return s.cost * float64(len(cs)), nil
+}
+
+// Solve returns acme.ErrNeedIdentifiers. Use SolveIdentifiers.
+func (s *Solver) Solve(cs []protocol.Challenge) ([]protocol.Response, func() error, error) {
+	return nil, nil, acme.ErrNeedIdentifiers
+}
+
+func (s *Solver) SolveIdentifiers(ids []acme.Identifier, cs []protocol.Challenge) ([]protocol.Response, func() error, error) {
+	return s.SolveIdentifiersCancel(ids, cs, nil)
+}
+
+// SolveIdentifiersCancel implements acme.CancelableSolver. Closing
+// cancel stops waiting for propagation.
+func (s *Solver) SolveIdentifiersCancel(ids []acme.Identifier, cs []protocol.Challenge, cancel <-chan struct{}) ([]protocol.Response, func() error, error) {
+	var recs []txtRecord
+	stop := func() error {
+		var err error
+		for _, rec := range recs {
+			if rerr := s.p.RemoveTXTRecord(rec.fqdn, rec.value); rerr != nil {
+				err = rerr
+			}
+		}
+		return err
+	}
+	errStop := stop
+	defer func() {
+		errStop()
+	}()
+
+	var resps []protocol.Response
+	for i, c := range cs {
+		dc, ok := c.(*protocol.DNS01Challenge)
+		if !ok {
+			return nil, nil, acme.ErrUnsolvable
+		}
+		fqdn, err := challengeFQDN(ids[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		fqdn, err = s.target(fqdn)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		resp, err := protocol.RespondDNS01(s.key, dc)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		rec := txtRecord{fqdn, protocol.DNS01TXTRecord(resp.KeyAuthorization)}
+		if err := s.p.AddTXTRecord(rec.fqdn, rec.value); err != nil {
+			return nil, nil, err
+		}
+		recs = append(recs, rec)
+		resps = append(resps, resp)
+	}
+
+	if s.checker != nil {
+		if err := s.waitPropagation(recs, cancel); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	errStop = func() error { return nil }
+	return resps, stop, nil
+}
+
+// waitPropagation waits for all records concurrently. It returns the
+// first failure, in record order, and stops waiting for the others
+// when one fails or cancel is closed.
+func (s *Solver) waitPropagation(recs []txtRecord, cancel <-chan struct{}) error {
+	quit := make(chan struct{})
+	var quitOnce sync.Once
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-cancel:
+			quitOnce.Do(func() { close(quit) })
+		case <-done:
+		}
+	}()
+
+	errs := make([]error, len(recs))
+	var wg sync.WaitGroup
+	for i, rec := range recs {
+		wg.Add(1)
+		go func(i int, rec txtRecord) {
+			defer wg.Done()
+			if errs[i] = s.checker.Wait(rec.fqdn, rec.value, quit); errs[i] != nil {
+				quitOnce.Do(func() { close(quit) })
+			}
+		}(i, rec)
+	}
+	wg.Wait()
+
+	select {
+	case <-cancel:
+		return acme.ErrCanceled
+	default:
+	}
+	// Records interrupted by another failure report ErrCanceled.
+	for _, err := range errs {
+		if err != nil && err != acme.ErrCanceled {
+			return err
+		}
+	}
+	return nil
+}
+
+// SelfCheck implements acme.SelfChecker. It verifies that the TXT
+// record is visible on all authoritative nameservers, using the
+// propagation checker if one was given.
+func (s *Solver) SelfCheck(id acme.Identifier, c protocol.Challenge, resp protocol.Response) error {
+	dresp, ok := resp.(*protocol.DNS01Response)
+	if !ok {
+		return fmt.Errorf("not a dns-01 response: %s", resp.GetType())
+	}
+	fqdn, err := challengeFQDN(id)
+	if err != nil {
+		return err
+	}
+	fqdn, err = s.target(fqdn)
+	if err != nil {
+		return err
+	}
+
+	checker := s.checker
+	if checker == nil {
+		checker = NewPropagationChecker(WithResolver(s.resolver))
+	}
+	return checker.Check(fqdn, protocol.DNS01TXTRecord(dresp.KeyAuthorization))
+}
+
+// target returns the name where the record for fqdn should be
+// published.
+func (s *Solver) target(fqdn string) (string, error) {
+	if t, ok := s.delegations[canonicalName(fqdn)]; ok {
+		return t, nil
+	}
+	if !s.delegate {
+		return fqdn, nil
+	}
+
+	resolver := s.resolver
+	if resolver == "" {
+		var err error
+		resolver, err = systemResolver()
+		if err != nil {
+			return "", err
+		}
+	}
+	return followCNAMEs(s.client, resolver, fqdn)
+}
+
+// txtRecord is a record added by SolveIdentifiers.
+type txtRecord struct {
+	fqdn  string
+	value string
+}
+
+// challengeFQDN returns the fully qualified name of the TXT record
+// used to validate a DNS identifier. Wildcards are validated at the
+// base domain.
+func challengeFQDN(id acme.Identifier) (string, error) {
+	dnsID, ok := id.(acme.DNSIdentifier)
+	if !ok {
+		return "", fmt.Errorf("dns-01 cannot validate identifier %v", id)
+	}
+
+	return protocol.DNS01Label + "." + strings.TrimSuffix(strings.TrimPrefix(string(dnsID), "*."), ".") + ".", nil
+}
+
+// canonicalName returns the lower-case, fully qualified form of name.
+func canonicalName(name string) string {
+	return strings.ToLower(dns.Fqdn(name))
+}
@@ -0,0 +1,286 @@
+package dns01
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tommie/acme-go"
+	"github.com/tommie/acme-go/protocol"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestSolverCost(t *testing.T) {
+	s := NewSolver(testJWK, &memProvider{}, WithCost(3))
+
+	got, err := s.Cost([]protocol.Challenge{dns01Challenge("a"), dns01Challenge("b")})
+	if err != nil {
+		t.Fatalf("Cost failed: %v", err)
+	}
+	if want := float64(6); got != want {
+		t.Errorf("Cost: got %v, want %v", got, want)
+	}
+
+	_, err = s.Cost([]protocol.Challenge{&protocol.HTTP01Challenge{Type: protocol.ChallengeHTTP01}})
+	if err != acme.ErrUnsolvable {
+		t.Errorf("Cost(http-01): got %v, want %v", err, acme.ErrUnsolvable)
+	}
+}
+
+func TestSolverSolve(t *testing.T) {
+	p := &memProvider{}
+	s := NewSolver(testJWK, p)
+
+	ids := []acme.Identifier{acme.DNSIdentifier("example.com"), acme.DNSIdentifier("*.example.com")}
+	cs := []protocol.Challenge{dns01Challenge("a"), dns01Challenge("b")}
+	resps, stop, err := s.SolveIdentifiers(ids, cs)
+	if err != nil {
+		t.Fatalf("SolveIdentifiers failed: %v", err)
+	}
+	if len(resps) != len(cs) {
+		t.Fatalf("SolveIdentifiers: got %d responses, want %d", len(resps), len(cs))
+	}
+
+	var want []string
+	for _, resp := range resps {
+		want = append(want, "_acme-challenge.example.com. "+protocol.DNS01TXTRecord(resp.(*protocol.DNS01Response).KeyAuthorization))
+	}
+	if !reflect.DeepEqual(p.recs, want) {
+		t.Errorf("SolveIdentifiers records: got %v, want %v", p.recs, want)
+	}
+
+	if err := stop(); err != nil {
+		t.Errorf("stop failed: %v", err)
+	}
+	if len(p.recs) != 0 {
+		t.Errorf("stop records: got %v, want none", p.recs)
+	}
+}
+
+func TestSolverSolveError(t *testing.T) {
+	p := &memProvider{failAfter: 1}
+	s := NewSolver(testJWK, p)
+
+	ids := []acme.Identifier{acme.DNSIdentifier("a.example.com"), acme.DNSIdentifier("b.example.com")}
+	_, _, err := s.SolveIdentifiers(ids, []protocol.Challenge{dns01Challenge("a"), dns01Challenge("b")})
+	if err == nil {
+		t.Fatalf("SolveIdentifiers: got success, want error")
+	}
+	if len(p.recs) != 0 {
+		t.Errorf("SolveIdentifiers records: got %v, want none", p.recs)
+	}
+}
+
+func TestSolverSolvePropagation(t *testing.T) {
+	ns := newFakeDNSUpdateServer(t,
+		`example.com. 60 IN SOA ns1.example.com. hostmaster.example.com. 1 3600 600 86400 60`,
+		`example.com. 60 IN NS ns1.example.com.`,
+		`ns1.example.com. 60 IN A 127.0.0.1`)
+	_, port, _ := net.SplitHostPort(ns.Addr)
+	s := NewSolver(testJWK,
+		NewRFC2136Provider(ns.Addr, testTSIGKeyName, testTSIGSecret),
+		WithPropagationChecker(NewPropagationChecker(
+			WithResolver(ns.Addr),
+			WithNameserverPort(port),
+			WithTimeout(time.Second),
+			WithPollInterval(10*time.Millisecond))))
+
+	resps, stop, err := s.SolveIdentifiers([]acme.Identifier{acme.DNSIdentifier("example.com")}, []protocol.Challenge{dns01Challenge("a")})
+	if err != nil {
+		t.Fatalf("SolveIdentifiers failed: %v", err)
+	}
+	want := []string{protocol.DNS01TXTRecord(resps[0].(*protocol.DNS01Response).KeyAuthorization)}
+	if got := ns.txt("_acme-challenge.example.com."); !reflect.DeepEqual(got, want) {
+		t.Errorf("SolveIdentifiers TXT: got %q, want %q", got, want)
+	}
+
+	if err := stop(); err != nil {
+		t.Errorf("stop failed: %v", err)
+	}
+	if got := ns.txt("_acme-challenge.example.com."); len(got) != 0 {
+		t.Errorf("stop TXT: got %q, want none", got)
+	}
+}
+
+func TestSolverSolveCancel(t *testing.T) {
+	ns := newFakeDNSServer(t,
+		`example.com. 60 IN NS ns1.example.com.`,
+		`ns1.example.com. 60 IN A 127.0.0.1`)
+	_, port, _ := net.SplitHostPort(ns.Addr)
+	p := &memProvider{}
+	s := NewSolver(testJWK, p,
+		WithPropagationChecker(NewPropagationChecker(
+			WithResolver(ns.Addr),
+			WithNameserverPort(port),
+			WithTimeout(time.Minute),
+			WithPollInterval(10*time.Millisecond))))
+
+	cancel := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(cancel)
+	}()
+	ids := []acme.Identifier{acme.DNSIdentifier("a.example.com"), acme.DNSIdentifier("b.example.com")}
+	_, _, err := s.SolveIdentifiersCancel(ids, []protocol.Challenge{dns01Challenge("a"), dns01Challenge("b")}, cancel)
+	if err != acme.ErrCanceled {
+		t.Fatalf("SolveIdentifiersCancel: got %v, want %v", err, acme.ErrCanceled)
+	}
+	if len(p.recs) != 0 {
+		t.Errorf("SolveIdentifiersCancel records: got %v, want none", p.recs)
+	}
+}
+
+func TestSolverSolveDelegation(t *testing.T) {
+	ns := newFakeDNSServer(t,
+		`_acme-challenge.example.com. 60 IN CNAME a.validation.example.net.`,
+		`a.validation.example.net. 60 IN CNAME b.validation.example.net.`)
+	tsts := []struct {
+		name string
+		opts []SolverOpt
+		id   string
+
+		want string
+	}{
+		{
+			name: "none",
+			id:   "example.com",
+
+			want: "_acme-challenge.example.com.",
+		},
+		{
+			name: "cname",
+			opts: []SolverOpt{WithCNAMEDelegation(ns.Addr)},
+			id:   "example.com",
+
+			want: "b.validation.example.net.",
+		},
+		{
+			name: "cname-missing",
+			opts: []SolverOpt{WithCNAMEDelegation(ns.Addr)},
+			id:   "www.example.com",
+
+			want: "_acme-challenge.www.example.com.",
+		},
+		{
+			name: "static",
+			opts: []SolverOpt{
+				WithCNAMEDelegation(ns.Addr),
+				WithDelegations(map[string]string{"_acme-challenge.Example.com": "static.example.org"}),
+			},
+			id: "example.com",
+
+			want: "static.example.org.",
+		},
+	}
+
+	for _, tst := range tsts {
+		p := &memProvider{}
+		s := NewSolver(testJWK, p, tst.opts...)
+
+		resps, stop, err := s.SolveIdentifiers([]acme.Identifier{acme.DNSIdentifier(tst.id)}, []protocol.Challenge{dns01Challenge("a")})
+		if err != nil {
+			t.Errorf("[%s] SolveIdentifiers failed: %v", tst.name, err)
+			continue
+		}
+		want := []string{tst.want + " " + protocol.DNS01TXTRecord(resps[0].(*protocol.DNS01Response).KeyAuthorization)}
+		if !reflect.DeepEqual(p.recs, want) {
+			t.Errorf("[%s] SolveIdentifiers records: got %v, want %v", tst.name, p.recs, want)
+		}
+		if err := stop(); err != nil {
+			t.Errorf("[%s] stop failed: %v", tst.name, err)
+		}
+	}
+}
+
+func TestSolverSelfCheck(t *testing.T) {
+	ns := newFakeDNSUpdateServer(t,
+		`example.com. 60 IN SOA ns1.example.com. hostmaster.example.com. 1 3600 600 86400 60`,
+		`example.com. 60 IN NS ns1.example.com.`,
+		`ns1.example.com. 60 IN A 127.0.0.1`)
+	_, port, _ := net.SplitHostPort(ns.Addr)
+	s := NewSolver(testJWK,
+		NewRFC2136Provider(ns.Addr, testTSIGKeyName, testTSIGSecret),
+		WithPropagationChecker(NewPropagationChecker(
+			WithResolver(ns.Addr),
+			WithNameserverPort(port))))
+
+	id := acme.DNSIdentifier("example.com")
+	c := dns01Challenge("a")
+	resp, err := protocol.RespondDNS01(testJWK, c)
+	if err != nil {
+		t.Fatalf("RespondDNS01 failed: %v", err)
+	}
+	if err := s.SelfCheck(id, c, resp); !errors.Is(err, ErrNotPropagated) {
+		t.Errorf("SelfCheck (before): got %v, want %v", err, ErrNotPropagated)
+	}
+
+	_, stop, err := s.SolveIdentifiers([]acme.Identifier{id}, []protocol.Challenge{c})
+	if err != nil {
+		t.Fatalf("SolveIdentifiers failed: %v", err)
+	}
+	defer stop()
+
+	if err := s.SelfCheck(id, c, resp); err != nil {
+		t.Errorf("SelfCheck failed: %v", err)
+	}
+}
+
+// memProvider is a DNSProvider keeping records in memory.
+type memProvider struct {
+	// failAfter makes AddTXTRecord fail after this many records, if non-zero.
+	failAfter int
+
+	mu   sync.Mutex
+	recs []string
+}
+
+func (p *memProvider) AddTXTRecord(fqdn, value string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failAfter > 0 && len(p.recs) >= p.failAfter {
+		return errors.New("mock error")
+	}
+	p.recs = append(p.recs, fqdn+" "+value)
+	return nil
+}
+
+func (p *memProvider) RemoveTXTRecord(fqdn, value string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, rec := range p.recs {
+		if rec == fqdn+" "+value {
+			p.recs = append(p.recs[:i], p.recs[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no such record: %s %s", fqdn, value)
+}
+
+func dns01Challenge(tok string) *protocol.DNS01Challenge {
+	return &protocol.DNS01Challenge{
+		Resource: protocol.ResourceChallenge,
+		Type:     protocol.ChallengeDNS01,
+		URI:      "http://example.com/chal/" + tok,
+		Token:    tok,
+	}
+}
+
+// testJWK is an account key used for tests.
+var testJWK = mustGenerateJWK()
+
+func mustGenerateJWK() *jose.JSONWebKey {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return &jose.JSONWebKey{Key: k.Public()}
+}
@@ -0,0 +1,90 @@
+package acme
+
+import (
+	"time"
+
+	"github.com/tommie/acme-go/protocol"
+)
+
+// An Observer receives progress events from a CertificateIssuer. It
+// is called synchronously, so it should return quickly. It may be
+// called concurrently from multiple goroutines.
+type Observer interface {
+	Observe(e Event)
+}
+
+// ObserverFunc adapts a function to the Observer interface.
+type ObserverFunc func(e Event)
+
+func (f ObserverFunc) Observe(e Event) { f(e) }
+
+// An Event is one of the *Event types in this package.
+type Event interface {
+	event()
+}
+
+// An AuthorizationCreatedEvent is sent when the server has returned
+// a new authorization for an identifier.
+type AuthorizationCreatedEvent struct {
+	Identifier    Identifier
+	Authorization *Authorization
+}
+
+// A CombinationChosenEvent is sent when a challenge combination has
+// been chosen for an authorization.
+type CombinationChosenEvent struct {
+	Identifier Identifier
+	Challenges []protocol.Challenge
+	Cost       float64
+}
+
+// A SolverStartedEvent is sent when Solve has returned successfully.
+type SolverStartedEvent struct {
+	Identifiers []Identifier
+	Challenges  []protocol.Challenge
+}
+
+// A SolverStoppedEvent is sent when the stop function returned by
+// Solve has been called. Err is the error it returned.
+type SolverStoppedEvent struct {
+	Identifiers []Identifier
+	Challenges  []protocol.Challenge
+	Err         error
+}
+
+// A ChallengeStatusEvent is sent when the status of a challenge has
+// been reported by the server, and differs from what was last seen.
+type ChallengeStatusEvent struct {
+	Identifier Identifier
+	Challenge  protocol.Challenge
+}
+
+// An AuthorizationPollEvent is sent when an authorization has been
+// polled and is not yet final. The issuer will wait for Wait before
+// continuing.
+type AuthorizationPollEvent struct {
+	Authorization *Authorization
+	Wait          time.Duration
+}
+
+// An AuthorizationDoneEvent is sent when an authorization has
+// become valid or invalid.
+type AuthorizationDoneEvent struct {
+	Authorization *Authorization
+}
+
+// An IssuedEvent is sent when certificate issuance has completed,
+// successfully or not.
+type IssuedEvent struct {
+	Certificate *Certificate
+	Err         error
+}
+
+func (*AuthorizationCreatedEvent) event() {}
+func (*CombinationChosenEvent) event()    {}
+func (*SolverStartedEvent) event()        {}
+func (*SolverStoppedEvent) event()        {}
+func (*ChallengeStatusEvent) event()      {}
+func (*AuthorizationPollEvent) event()    {}
+func (*AuthorizationDoneEvent) event()    {}
+func (*IssuedEvent) event()               {}
@@ -0,0 +1,78 @@
+package acme
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/tommie/acme-go/protocol"
+)
+
+func TestCertificateIssuerObserver(t *testing.T) {
+	s := &stubSolver{
+		costs: map[protocol.ChallengeType]float64{protocol.ChallengeHTTP01: 1, protocol.ChallengeDNS01: 2},
+		resps: map[protocol.ChallengeType]protocol.Response{
+			protocol.ChallengeHTTP01: &protocol.HTTP01Response{Type: protocol.ChallengeHTTP01},
+		},
+	}
+	var mu sync.Mutex
+	polls := map[string]int{}
+	ia := &stubIssuingAccount{
+		authzID: func(id Identifier) (*Authorization, error) {
+			return testPendingAuthorization("/authz/"+id.String(), id), nil
+		},
+		authz: func(uri string) (*Authorization, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			polls[uri]++
+			if polls[uri] == 1 {
+				return &Authorization{URI: uri, Status: protocol.StatusPending}, nil
+			}
+			return &Authorization{URI: uri, Status: protocol.StatusValid}, nil
+		},
+		validate: func(uri string, resp protocol.Response) (protocol.Challenge, error) {
+			return &protocol.HTTP01Challenge{Type: resp.GetType(), URI: uri, Status: protocol.StatusPending}, nil
+		},
+		issue: func(csr []byte) (*Certificate, error) {
+			return &Certificate{URI: "http://example.com/cert/4"}, nil
+		},
+	}
+
+	var got []string
+	var costs []float64
+	o := ObserverFunc(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, fmt.Sprintf("%T", e))
+		if e, ok := e.(*CombinationChosenEvent); ok {
+			costs = append(costs, e.Cost)
+		}
+	})
+
+	if _, err := NewCertificateIssuer(ia, WithObserver(o)).AuthorizeAndIssue(testCSR, s); err != nil {
+		t.Fatalf("AuthorizeAndIssue failed: %v", err)
+	}
+
+	want := []string{
+		"*acme.AuthorizationCreatedEvent",
+		"*acme.AuthorizationCreatedEvent",
+		"*acme.CombinationChosenEvent",
+		"*acme.CombinationChosenEvent",
+		"*acme.SolverStartedEvent",
+		"*acme.ChallengeStatusEvent",
+		"*acme.ChallengeStatusEvent",
+		"*acme.AuthorizationPollEvent",
+		"*acme.AuthorizationDoneEvent",
+		"*acme.AuthorizationPollEvent",
+		"*acme.AuthorizationDoneEvent",
+		"*acme.SolverStoppedEvent",
+		"*acme.IssuedEvent",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AuthorizeAndIssue events: got %v, want %v", got, want)
+	}
+	if want := []float64{1, 1}; !reflect.DeepEqual(costs, want) {
+		t.Errorf("AuthorizeAndIssue costs: got %v, want %v", costs, want)
+	}
+}
@@ -0,0 +1,196 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/tommie/acme-go/protocol"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// An ExecSolver is a Solver running external commands to present
+// and clean up challenge responses. This allows integrating with
+// existing tooling. Each command is run once per challenge, with
+// information in environment variables:
+//
+//	ACME_CHALLENGE_TYPE     e.g. "http-01"
+//	ACME_IDENTIFIER_TYPE    e.g. "dns"
+//	ACME_IDENTIFIER         e.g. "www.example.com"
+//	ACME_TOKEN              the challenge token, if any
+//	ACME_KEY_AUTHORIZATION  the key authorization, if any
+//	ACME_DNS01_TXT_RECORD   the dns-01 TXT record value, if any
+//
+// The same information is written as an ExecHookRequest JSON object
+// on stdin.
+type ExecSolver struct {
+	key     *jose.JSONWebKey
+	present []string
+	cleanup []string
+	costs   map[protocol.ChallengeType]float64
+}
+
+// ExecHookRequest is the JSON object written to the standard input
+// of ExecSolver commands.
+type ExecHookRequest struct {
+	Type             protocol.ChallengeType `json:"type"`
+	Identifier       protocol.Identifier    `json:"identifier"`
+	Token            string                 `json:"token,omitempty"`
+	KeyAuthorization string                 `json:"keyAuthorization,omitempty"`
+	DNS01TXTRecord   string                 `json:"dns01TXTRecord,omitempty"`
+}
+
+// NewExecSolver creates a new solver. present and cleanup are
+// commands with arguments. The cleanup command is optional. costs
+// gives the cost of solving a challenge of each type. Challenge
+// types missing in costs are unsolvable. The key is the account key,
+// used to create key authorizations.
+func NewExecSolver(key *jose.JSONWebKey, present, cleanup []string, costs map[protocol.ChallengeType]float64) *ExecSolver {
+	return &ExecSolver{
+		key:     key,
+		present: present,
+		cleanup: cleanup,
+		costs:   costs,
+	}
+}
+
+func (s *ExecSolver) Cost(cs []protocol.Challenge) (float64, error) {
+	var ret float64
+	for _, c := range cs {
+		cost, ok := s.costs[c.GetType()]
+		if !ok {
+			return 0, ErrUnsolvable
+		}
+		ret += cost
+	}
+
+	return ret, nil
+}
+
+// Solve returns ErrNeedIdentifiers. Use SolveIdentifiers.
+func (s *ExecSolver) Solve(cs []protocol.Challenge) ([]protocol.Response, func() error, error) {
+	return nil, nil, ErrNeedIdentifiers
+}
+
+func (s *ExecSolver) SolveIdentifiers(ids []Identifier, cs []protocol.Challenge) ([]protocol.Response, func() error, error) {
+	if len(s.present) == 0 {
+		return nil, nil, fmt.Errorf("no present command configured")
+	}
+
+	var reqs []*ExecHookRequest
+	stop := func() error {
+		if len(s.cleanup) == 0 {
+			return nil
+		}
+		var err error
+		for i := len(reqs) - 1; i >= 0; i-- {
+			if cerr := runExecHook(s.cleanup, reqs[i]); cerr != nil {
+				err = cerr
+			}
+		}
+		return err
+	}
+	errStop := stop
+	defer func() {
+		errStop()
+	}()
+
+	var resps []protocol.Response
+	for i, c := range cs {
+		if _, ok := s.costs[c.GetType()]; !ok {
+			return nil, nil, ErrUnsolvable
+		}
+
+		req, resp, err := s.respond(ids[i], c)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := runExecHook(s.present, req); err != nil {
+			return nil, nil, err
+		}
+		reqs = append(reqs, req)
+		resps = append(resps, resp)
+	}
+
+	errStop = func() error { return nil }
+	return resps, stop, nil
+}
+
+// respond creates a response to a challenge, and the hook request
+// describing it.
+func (s *ExecSolver) respond(id Identifier, c protocol.Challenge) (*ExecHookRequest, protocol.Response, error) {
+	req := &ExecHookRequest{
+		Type:       c.GetType(),
+		Identifier: *id.Protocol(),
+	}
+
+	switch c := c.(type) {
+	case *protocol.HTTP01Challenge:
+		resp, err := protocol.RespondHTTP01(s.key, c)
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Token = c.Token
+		req.KeyAuthorization = resp.KeyAuthorization
+		return req, resp, nil
+
+	case *protocol.DNS01Challenge:
+		resp, err := protocol.RespondDNS01(s.key, c)
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Token = c.Token
+		req.KeyAuthorization = resp.KeyAuthorization
+		req.DNS01TXTRecord = protocol.DNS01TXTRecord(resp.KeyAuthorization)
+		return req, resp, nil
+
+	case *protocol.TLSALPN01Challenge:
+		resp, err := protocol.RespondTLSALPN01(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		ka, err := protocol.KeyAuthz(c.Token, s.key)
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Token = c.Token
+		req.KeyAuthorization = ka
+		return req, resp, nil
+
+	case *protocol.GenericChallenge:
+		// The hook knows what to do with the type.
+		return req, &protocol.GenericResponse{Resource: c.Resource, Type: c.Type}, nil
+
+	default:
+		return nil, nil, fmt.Errorf("exec solver cannot respond to %s challenges", c.GetType())
+	}
+}
+
+// runExecHook runs a command with the request in the environment and
+// on stdin. The output is included in the error if the command fails.
+func runExecHook(args []string, req *ExecHookRequest) error {
+	bs, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"ACME_CHALLENGE_TYPE="+string(req.Type),
+		"ACME_IDENTIFIER_TYPE="+string(req.Identifier.Type),
+		"ACME_IDENTIFIER="+req.Identifier.Value,
+		"ACME_TOKEN="+req.Token,
+		"ACME_KEY_AUTHORIZATION="+req.KeyAuthorization,
+		"ACME_DNS01_TXT_RECORD="+req.DNS01TXTRecord)
+	cmd.Stdin = bytes.NewReader(bs)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s for %s %s failed: %v: %s", args[0], req.Type, req.Identifier.Value, err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package acme
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tommie/acme-go/protocol"
+)
+
+func TestExecSolverCost(t *testing.T) {
+	s := NewExecSolver(testJWK, []string{"true"}, nil, map[protocol.ChallengeType]float64{protocol.ChallengeHTTP01: 2})
+
+	got, err := s.Cost([]protocol.Challenge{&protocol.HTTP01Challenge{Type: protocol.ChallengeHTTP01}})
+	if err != nil {
+		t.Fatalf("Cost failed: %v", err)
+	}
+	if want := float64(2); got != want {
+		t.Errorf("Cost: got %v, want %v", got, want)
+	}
+
+	if _, err := s.Cost([]protocol.Challenge{&protocol.DNS01Challenge{Type: protocol.ChallengeDNS01}}); err != ErrUnsolvable {
+		t.Errorf("Cost(dns-01): got %v, want %v", err, ErrUnsolvable)
+	}
+}
+
+func TestExecSolverSolve(t *testing.T) {
+	dir := t.TempDir()
+	present := []string{"sh", "-c", `cat >"$0/present-$ACME_TOKEN.json"; echo "$ACME_CHALLENGE_TYPE $ACME_IDENTIFIER $ACME_DNS01_TXT_RECORD" >"$0/present-$ACME_TOKEN.env"`, dir}
+	cleanup := []string{"sh", "-c", `echo "$ACME_TOKEN" >>"$0/cleanup"`, dir}
+	s := NewExecSolver(testJWK, present, cleanup, map[protocol.ChallengeType]float64{protocol.ChallengeDNS01: 1, protocol.ChallengeHTTP01: 1})
+
+	ids := []Identifier{DNSIdentifier("a.example.com"), DNSIdentifier("b.example.com")}
+	cs := []protocol.Challenge{
+		&protocol.DNS01Challenge{Resource: protocol.ResourceChallenge, Type: protocol.ChallengeDNS01, Token: "tok1"},
+		&protocol.HTTP01Challenge{Resource: protocol.ResourceChallenge, Type: protocol.ChallengeHTTP01, Token: "tok2"},
+	}
+	resps, stop, err := s.SolveIdentifiers(ids, cs)
+	if err != nil {
+		t.Fatalf("SolveIdentifiers failed: %v", err)
+	}
+	ka := resps[0].(*protocol.DNS01Response).KeyAuthorization
+
+	var got ExecHookRequest
+	if err := json.Unmarshal(mustReadFile(t, filepath.Join(dir, "present-tok1.json")), &got); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	want := ExecHookRequest{
+		Type:             protocol.ChallengeDNS01,
+		Identifier:       protocol.Identifier{Type: protocol.DNS, Value: "a.example.com"},
+		Token:            "tok1",
+		KeyAuthorization: ka,
+		DNS01TXTRecord:   protocol.DNS01TXTRecord(ka),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SolveIdentifiers stdin: got %+v, want %+v", got, want)
+	}
+	if got, want := string(mustReadFile(t, filepath.Join(dir, "present-tok1.env"))), "dns-01 a.example.com "+protocol.DNS01TXTRecord(ka)+"\n"; got != want {
+		t.Errorf("SolveIdentifiers env: got %q, want %q", got, want)
+	}
+	if got, want := string(mustReadFile(t, filepath.Join(dir, "present-tok2.env"))), "http-01 b.example.com \n"; got != want {
+		t.Errorf("SolveIdentifiers env: got %q, want %q", got, want)
+	}
+
+	if err := stop(); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+	if got, want := string(mustReadFile(t, filepath.Join(dir, "cleanup"))), "tok2\ntok1\n"; got != want {
+		t.Errorf("stop cleanup: got %q, want %q", got, want)
+	}
+}
+
+func TestExecSolverSolvePresentError(t *testing.T) {
+	dir := t.TempDir()
+	present := []string{"sh", "-c", `[ "$ACME_TOKEN" = tok1 ] || { echo mock error; exit 1; }`}
+	cleanup := []string{"sh", "-c", `echo "$ACME_TOKEN" >>"$0/cleanup"`, dir}
+	s := NewExecSolver(testJWK, present, cleanup, map[protocol.ChallengeType]float64{protocol.ChallengeHTTP01: 1})
+
+	ids := []Identifier{DNSIdentifier("a.example.com"), DNSIdentifier("b.example.com")}
+	cs := []protocol.Challenge{
+		&protocol.HTTP01Challenge{Resource: protocol.ResourceChallenge, Type: protocol.ChallengeHTTP01, Token: "tok1"},
+		&protocol.HTTP01Challenge{Resource: protocol.ResourceChallenge, Type: protocol.ChallengeHTTP01, Token: "tok2"},
+	}
+	_, _, err := s.SolveIdentifiers(ids, cs)
+	if err == nil || !strings.HasSuffix(err.Error(), "mock error") {
+		t.Errorf("SolveIdentifiers: got %v, want suffix %q", err, "mock error")
+	}
+	if got, want := string(mustReadFile(t, filepath.Join(dir, "cleanup"))), "tok1\n"; got != want {
+		t.Errorf("SolveIdentifiers cleanup: got %q, want %q", got, want)
+	}
+}
+
+func TestExecSolverStopError(t *testing.T) {
+	s := NewExecSolver(testJWK, []string{"true"}, []string{"false"}, map[protocol.ChallengeType]float64{protocol.ChallengeHTTP01: 1})
+
+	_, stop, err := s.SolveIdentifiers(
+		[]Identifier{DNSIdentifier("a.example.com")},
+		[]protocol.Challenge{&protocol.HTTP01Challenge{Resource: protocol.ResourceChallenge, Type: protocol.ChallengeHTTP01, Token: "tok1"}})
+	if err != nil {
+		t.Fatalf("SolveIdentifiers failed: %v", err)
+	}
+	if err := stop(); err == nil {
+		t.Errorf("stop: got success, want error")
+	}
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	return bs
+}
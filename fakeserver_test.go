@@ -18,24 +18,27 @@ import (
 
 var errBadNonce = errors.New("bad nonce")
 
-type fakeACMEServer struct{}
+type fakeACMEServer struct {
+	// baseURI is the URL of the listener.
+	baseURI string
+}
 
 // newFakeACMEServer creates a fake ACME server and starts a listener.
 func newFakeACMEServer() (*fakeACMEServer, *httptest.Server) {
-	as := &fakeACMEServer{}
 	mux := http.NewServeMux()
 	hts := httptest.NewServer(mux)
 	u, err := url.Parse(hts.URL)
 	if err != nil {
 		panic(err)
 	}
+	as := &fakeACMEServer{baseURI: hts.URL}
 	RegisterBoulderHTTP(mux, u, as, newIntNonceSource())
 
 	return as, hts
 }
 
 func (s *fakeACMEServer) RegisterAccount(accountKey crypto.PublicKey, reg *Registration) (*Registration, error) {
-	reg.URI = "http://example.com/reg/1"
+	reg.URI = s.baseURI + protocol.RegPath + "1"
 	return reg, nil
 }
 
@@ -5,15 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"net"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/tommie/acme-go/protocol"
 )
 
 var (
-	ErrCanceled   = errors.New("operation canceled")
-	ErrUnsolvable = errors.New("unsolvable challenge")
+	ErrCanceled            = errors.New("operation canceled")
+	ErrUnsolvable          = errors.New("unsolvable challenge")
+	ErrAuthorizationFailed = errors.New("all challenge combinations failed")
+	ErrNeedIdentifiers     = errors.New("solver needs identifiers")
 )
 
 // An AuthorizationError wraps another error and adds information about what
@@ -21,6 +26,19 @@ var (
 type AuthorizationError struct {
 	Err            error
 	Authorizations []*Authorization
+
+	// Attempts lists the failed attempts made before giving up.
+	Attempts []*AuthorizationAttempt
+}
+
+// An AuthorizationAttempt describes an attempt to fulfill an
+// authorization using a combination of challenges.
+type AuthorizationAttempt struct {
+	// Authorization is the final state of the authorization.
+	Authorization *Authorization
+
+	// Challenges is the combination of challenges that was tried.
+	Challenges []protocol.Challenge
 }
 
 func (e *AuthorizationError) Error() string {
@@ -36,19 +54,191 @@ func (e *AuthorizationError) Error() string {
 		}
 		auths = append(auths, auth)
 	}
-	return fmt.Sprintf("%s (authorizations %s)", e.Err, strings.Join(auths, ", "))
+	ret := fmt.Sprintf("%s (authorizations %s)", e.Err, strings.Join(auths, ", "))
+
+	if len(e.Attempts) > 0 {
+		var atts []string
+		for _, at := range e.Attempts {
+			atts = append(atts, fmt.Sprintf("%s using (%s)", at.Authorization.Identifier, combinationKey(at.Challenges)))
+		}
+		ret += fmt.Sprintf(" (failed attempts %s)", strings.Join(atts, ", "))
+	}
+
+	if fs := e.Failures(); len(fs) > 0 {
+		var fstrs []string
+		for _, f := range fs {
+			fstrs = append(fstrs, f.String())
+		}
+		ret += fmt.Sprintf(" (challenge failures %s)", strings.Join(fstrs, "; "))
+	}
+
+	return ret
+}
+
+func (e *AuthorizationError) Unwrap() error { return e.Err }
+
+// Identifiers returns the identifiers that could not be authorized.
+func (e *AuthorizationError) Identifiers() []Identifier {
+	var ret []Identifier
+	for _, a := range e.Authorizations {
+		ret = append(ret, a.Identifier)
+	}
+	return ret
+}
+
+// Failures returns the failed challenges of all attempts, as last
+// reported by the server.
+func (e *AuthorizationError) Failures() []*ChallengeFailure {
+	var ret []*ChallengeFailure
+	for _, at := range e.Attempts {
+		ret = append(ret, at.Failures()...)
+	}
+	return ret
+}
+
+// Remediation returns a human-readable summary of the failures, with
+// hints on how to fix common problems.
+func (e *AuthorizationError) Remediation() string {
+	fs := e.Failures()
+	if len(fs) == 0 {
+		return fmt.Sprintf("Authorization failed: %v.", e.Err)
+	}
+
+	var lines []string
+	for _, f := range fs {
+		line := f.String()
+		if f.Problem != nil {
+			if hint, ok := problemHints[f.Problem.Type]; ok {
+				line += ". " + fmt.Sprintf(hint, f.Identifier.Protocol().Value, f.Type)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// problemHints maps problem types to remediation hints. The
+// arguments are the identifier value and challenge type.
+var problemHints = map[protocol.ProblemType]string{
+	protocol.ConnectionError: "Check that %s is reachable from the Internet for %s, e.g. that no firewall blocks it",
+	protocol.DNSSECError:     "Check the DNSSEC configuration of %s (used for %s)",
+	protocol.TLSError:        "Check the TLS configuration of %s (used for %s)",
+	protocol.Unauthorized:    "The server saw the wrong response for %s; check that the %s solver is the one answering",
+	protocol.UnknownHost:     "Check that %s exists in DNS (needed for %s)",
+}
+
+// Failures returns the challenges of the combination that failed, as
+// last reported by the server.
+func (at *AuthorizationAttempt) Failures() []*ChallengeFailure {
+	tried := map[string]bool{}
+	for _, c := range at.Challenges {
+		tried[c.GetURI()] = true
+	}
+
+	var ret []*ChallengeFailure
+	for _, c := range at.Authorization.Challenges {
+		if !tried[c.GetURI()] {
+			continue
+		}
+		if c.GetStatus() != protocol.StatusInvalid && c.GetError() == nil {
+			continue
+		}
+		ret = append(ret, &ChallengeFailure{
+			Identifier: at.Authorization.Identifier,
+			Type:       c.GetType(),
+			URI:        c.GetURI(),
+			Status:     c.GetStatus(),
+			Validated:  c.GetValidated(),
+			Problem:    c.GetError(),
+		})
+	}
+	return ret
+}
+
+// A ChallengeFailure describes a challenge the server failed to
+// validate.
+type ChallengeFailure struct {
+	Identifier Identifier
+	Type       protocol.ChallengeType
+	URI        string
+	Status     protocol.Status
+	Validated  *protocol.Time
+
+	// Problem is the error reported by the server, if any.
+	Problem *protocol.Problem
+}
+
+func (f *ChallengeFailure) String() string {
+	if f.Problem == nil {
+		return fmt.Sprintf("%s %s: %s", f.Identifier, f.Type, f.Status)
+	}
+	return fmt.Sprintf("%s %s: %s (%s)", f.Identifier, f.Type, f.Problem.Detail, f.Problem.Type)
 }
 
 // A CertificateIssuer can authorize and issue certificates in one
-// go. A currently running issuer can be canceled.
+// go. A currently running issuer can be canceled. Use Start to run
+// issuance as jobs that can be canceled individually.
 type CertificateIssuer struct {
-	ia IssuingAccount
+	ia          IssuingAccount
+	selfCheck   SelfChecker
+	observer    Observer
+	concurrency int
+	replaces    string
+	verify      bool
+	roots       *x509.CertPool
 
 	cancel chan struct{}
 }
 
-func NewCertificateIssuer(ia IssuingAccount) *CertificateIssuer {
-	return &CertificateIssuer{ia, make(chan struct{})}
+// A CertificateIssuerOpt is an option for NewCertificateIssuer.
+type CertificateIssuerOpt func(*CertificateIssuer)
+
+// WithSelfCheck makes the issuer verify each solved challenge with
+// the given checker before asking the server to validate it. A
+// failing check stops the issuance with a *SelfCheckError.
+func WithSelfCheck(sc SelfChecker) CertificateIssuerOpt {
+	return func(ci *CertificateIssuer) {
+		ci.selfCheck = sc
+	}
+}
+
+// WithObserver makes the issuer report progress events to o.
+func WithObserver(o Observer) CertificateIssuerOpt {
+	return func(ci *CertificateIssuer) {
+		ci.observer = o
+	}
+}
+
+// WithConcurrency sets the maximum number of authorizations created
+// or polled at the same time. The default is 1. The IssuingAccount
+// must be concurrency-safe if n > 1.
+func WithConcurrency(n int) CertificateIssuerOpt {
+	return func(ci *CertificateIssuer) {
+		if n < 1 {
+			n = 1
+		}
+		ci.concurrency = n
+	}
+}
+
+// WithVerification makes the issuer check issued certificates with
+// VerifyCertificate. The issuer chain is fetched if the IssuingAccount
+// is a CertificateGetter. If roots is not nil, the chain must verify
+// against it. A mismatch fails the issuance with an
+// *UnexpectedCertificateError.
+func WithVerification(roots *x509.CertPool) CertificateIssuerOpt {
+	return func(ci *CertificateIssuer) {
+		ci.verify = true
+		ci.roots = roots
+	}
+}
+
+func NewCertificateIssuer(ia IssuingAccount, opts ...CertificateIssuerOpt) *CertificateIssuer {
+	ci := &CertificateIssuer{ia: ia, concurrency: 1, cancel: make(chan struct{})}
+	for _, opt := range opts {
+		opt(ci)
+	}
+	return ci
 }
 
 // AuthorizeAndIssue issues a certificate based on a signing request
@@ -62,97 +252,301 @@ func NewCertificateIssuer(ia IssuingAccount) *CertificateIssuer {
 // If one solver instance is used for multiple types, and the server
 // requests solving all types, they may be lumped together in the same
 // call to Solve.
+//
+// If an authorization fails validation, it is retried with the next
+// cheapest combination of challenges, using a new authorization if
+// needed. When no combinations remain, an *AuthorizationError
+// describing all attempts is returned.
 func (ci *CertificateIssuer) AuthorizeAndIssue(csr []byte, s Solver) (*Certificate, error) {
 	as, err := ci.authorizeIdentities(csr)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(as) > 0 {
-		cs, err := bestChallenges(s, as)
+	if err := ci.authorize(s, as); err != nil {
+		return nil, err
+	}
+
+	cert, err := ci.issue(csr)
+	ci.emit(&IssuedEvent{Certificate: cert, Err: err})
+	return cert, err
+}
+
+// Replacing returns a copy of the issuer that tells the server that
+// issued certificates replace the one with the given CertID, if the
+// IssuingAccount is a ReplacingAccount. The copy is canceled along
+// with the original.
+func (ci *CertificateIssuer) Replacing(certID string) *CertificateIssuer {
+	rci := *ci
+	rci.replaces = certID
+	return &rci
+}
+
+// issue issues a certificate, as a replacement if requested.
+func (ci *CertificateIssuer) issue(csr []byte) (*Certificate, error) {
+	var cert *Certificate
+	var err error
+	if ra, ok := ci.ia.(ReplacingAccount); ok && ci.replaces != "" {
+		cert, err = ra.ReplaceCertificate(csr, ci.replaces)
+	} else {
+		cert, err = ci.ia.IssueCertificate(csr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ci.verifyIssued(csr, cert); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// verifyIssued checks an issued certificate against its CSR, if
+// verification is enabled.
+func (ci *CertificateIssuer) verifyIssued(csr []byte, cert *Certificate) error {
+	if !ci.verify {
+		return nil
+	}
+
+	opts := VerifyOptions{Roots: ci.roots}
+	if cg, ok := ci.ia.(CertificateGetter); ok {
+		for _, uri := range cert.IssuerURIs {
+			ic, err := cg.Certificate(uri)
+			if err != nil {
+				return &UnexpectedCertificateError{URI: cert.URI, Err: ErrCertificateChain, Detail: err.Error()}
+			}
+			opts.Intermediates = append(opts.Intermediates, ic.Bytes)
+		}
+	}
+
+	if _, err := VerifyCertificate(csr, cert.Bytes, opts); err != nil {
+		if ue, ok := err.(*UnexpectedCertificateError); ok {
+			ue.URI = cert.URI
+		}
+		return err
+	}
+	return nil
+}
+
+// emit sends an event to the observer, if any.
+func (ci *CertificateIssuer) emit(e Event) {
+	if ci.observer != nil {
+		ci.observer.Observe(e)
+	}
+}
+
+// authorize solves challenges for pending authorizations, and waits
+// for them to become valid. Failed authorizations are retried with
+// combinations not yet tried for the identifier. Identifiers with no
+// combinations left are reported together in an *AuthorizationError
+// once the others are done.
+func (ci *CertificateIssuer) authorize(s Solver, as []*Authorization) error {
+	var attempts []*AuthorizationAttempt
+	var allExhausted []*Authorization
+	tried := map[string]map[string]bool{}
+
+	for len(as) > 0 {
+		combs, err := bestChallenges(s, as, tried)
 		if err != nil {
-			return nil, &AuthorizationError{err, as}
+			return &AuthorizationError{Err: err, Authorizations: append(allExhausted, as...), Attempts: attempts}
+		}
+		if ci.observer != nil {
+			for i, cs := range combs {
+				cost, _ := s.Cost(cs)
+				ci.emit(&CombinationChosenEvent{Identifier: as[i].Identifier, Challenges: cs, Cost: cost})
+			}
 		}
 
-		stop, err := ci.startSolver(s, cs)
+		failed, err := ci.authorizeOnce(s, as, combs)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		defer stop()
 
-		if err := ci.waitAuthorizations(as); err != nil {
-			return nil, err
+		var retry, exhausted []*Authorization
+		for i, a := range failed {
+			if a == nil {
+				continue
+			}
+			attempts = append(attempts, &AuthorizationAttempt{Authorization: a, Challenges: combs[i]})
+			id := a.Identifier.String()
+			if tried[id] == nil {
+				tried[id] = map[string]bool{}
+			}
+			tried[id][combinationKey(combs[i])] = true
+
+			// The server offers the same combinations in a new
+			// authorization, so the old one tells what is left.
+			if _, err := bestCombination(s, as[i], tried[id]); err != nil {
+				exhausted = append(exhausted, a)
+				continue
+			}
+			retry = append(retry, a)
+		}
+		allExhausted = append(allExhausted, exhausted...)
+
+		as, err = ci.reauthorize(retry)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(allExhausted) > 0 {
+		return &AuthorizationError{Err: ErrAuthorizationFailed, Authorizations: allExhausted, Attempts: attempts}
+	}
+
+	return nil
+}
+
+// authorizeOnce starts the solver for the given combinations, one
+// per authorization, and waits for the authorizations to
+// complete. Returns the final state of invalid authorizations, at
+// the same index as in as, or nil for valid ones.
+func (ci *CertificateIssuer) authorizeOnce(s Solver, as []*Authorization, combs [][]protocol.Challenge) ([]*Authorization, error) {
+	var ids []Identifier
+	var cs []protocol.Challenge
+	for i, comb := range combs {
+		for _, c := range comb {
+			ids = append(ids, as[i].Identifier)
+			cs = append(cs, c)
 		}
 	}
 
-	return ci.ia.IssueCertificate(csr)
+	stop, err := ci.startSolver(s, ids, cs)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	return ci.waitAuthorizations(as)
+}
+
+// reauthorize requests new authorizations for the identifiers of
+// failed authorizations. Only pending authorizations are returned.
+func (ci *CertificateIssuer) reauthorize(as []*Authorization) ([]*Authorization, error) {
+	ids := make([]Identifier, len(as))
+	for i, a := range as {
+		ids[i] = a.Identifier
+	}
+	return ci.authorizeIDs(ids)
 }
 
 // authorizeIdentities requests new challenges for the given X.509
-// CSR. Only pending authorizations are returned. If any authorization
-// is invalid, the call fails.
+// CSR. Only pending authorizations are returned, in the order the
+// names appear in the CSR, starting with the common name. If any
+// authorization is invalid, the call fails.
 func (ci *CertificateIssuer) authorizeIdentities(csr []byte) ([]*Authorization, error) {
 	pcsr, err := x509.ParseCertificateRequest(csr)
 	if err != nil {
 		return nil, err
 	}
 
-	// De-duplicate names.
-	names := make(map[string]Identifier, 1+len(pcsr.DNSNames))
-	for _, n := range append([]string{pcsr.Subject.CommonName}, pcsr.DNSNames...) {
-		names[n] = DNSIdentifier(n)
-	}
+	// TODO: Check for existing valid (and pending) authorizations first?
+	// Whether an existing authz is useful or not depends on how long it
+	// will remain useful, and we don't have that information.
+	return ci.authorizeIDs(csrIdentifiers(pcsr))
+}
 
-	var ret []*Authorization
-	for n, id := range names {
-		if ci.isCanceled() {
-			return nil, ErrCanceled
+// csrIdentifiers returns the de-duplicated identifiers of a CSR, in
+// the order they appear, starting with the common name and followed
+// by IP addresses.
+func csrIdentifiers(csr *x509.CertificateRequest) []Identifier {
+	var ids []Identifier
+	seen := make(map[string]bool, 1+len(csr.DNSNames)+len(csr.IPAddresses))
+	add := func(id Identifier) {
+		if seen[id.String()] {
+			return
 		}
-
-		// TODO: Check for existing valid (and pending) authorizations first?
-		// Whether an existing authz is useful or not depends on how long it
-		// will remain useful, and we don't have that information.
-		a, err := ci.ia.AuthorizeIdentity(id)
-		if err != nil {
-			return nil, err
+		seen[id.String()] = true
+		ids = append(ids, id)
+	}
+	for _, n := range append([]string{csr.Subject.CommonName}, csr.DNSNames...) {
+		if n == "" {
+			continue
 		}
-		switch a.Status {
-		case protocol.StatusPending:
-			ret = append(ret, a)
-
-		case protocol.StatusInvalid:
-			return nil, fmt.Errorf("authorization invalid for %q", n)
+		if ip := net.ParseIP(n); ip != nil {
+			// A common name may hold an IP address.
+			add(IPIdentifier(ip.String()))
+			continue
+		}
+		add(DNSIdentifier(n))
+	}
+	for _, ip := range csr.IPAddresses {
+		add(IPIdentifier(ip.String()))
+	}
+	return ids
+}
 
-		case protocol.StatusValid:
-			// nothing
+// authorizeIDs requests new authorizations for the identifiers. Only
+// pending authorizations are returned, in the same order as ids. If
+// any authorization is invalid, the call fails.
+func (ci *CertificateIssuer) authorizeIDs(ids []Identifier) ([]*Authorization, error) {
+	as := make([]*Authorization, len(ids))
+	err := ci.parallel(len(ids), func(i int, quit <-chan struct{}) error {
+		a, err := ci.authorizeID(ids[i])
+		as[i] = a
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		default:
-			return nil, fmt.Errorf("unknown authorization status for %q: %v", n, a.Status)
+	var ret []*Authorization
+	for _, a := range as {
+		if a != nil {
+			ret = append(ret, a)
 		}
 	}
 
 	return ret, nil
 }
 
-// bestChallenges picks challenges with lowest cost to solve.
-func bestChallenges(s Solver, as []*Authorization) ([]protocol.Challenge, error) {
-	var ret []protocol.Challenge
+// authorizeID requests a new authorization for an identifier. Returns
+// nil if it is already valid, and an error if it is invalid.
+func (ci *CertificateIssuer) authorizeID(id Identifier) (*Authorization, error) {
+	a, err := ci.ia.AuthorizeIdentity(id)
+	if err != nil {
+		return nil, err
+	}
+	ci.emit(&AuthorizationCreatedEvent{Identifier: id, Authorization: a})
+	switch a.Status {
+	case protocol.StatusPending:
+		return a, nil
+
+	case protocol.StatusInvalid:
+		return nil, fmt.Errorf("authorization invalid for %q", id)
+
+	case protocol.StatusValid:
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("unknown authorization status for %q: %v", id, a.Status)
+	}
+}
+
+// bestChallenges picks the challenge combination with lowest cost to
+// solve for each authorization. tried maps identifier strings to
+// combination keys that should not be used again.
+func bestChallenges(s Solver, as []*Authorization, tried map[string]map[string]bool) ([][]protocol.Challenge, error) {
+	var ret [][]protocol.Challenge
+	var all []protocol.Challenge
 	for _, a := range as {
-		cs, err := bestCombination(s, a)
+		cs, err := bestCombination(s, a, tried[a.Identifier.String()])
 		if err != nil {
 			return nil, err
 		}
-		ret = append(ret, cs...)
+		ret = append(ret, cs)
+		all = append(all, cs...)
 	}
 
 	// We have combined challenges. Make sure we can solve them together.
-	_, err := s.Cost(ret)
+	_, err := s.Cost(all)
 	return ret, err
 }
 
 // bestCombination finds the challenge combination with a lowest
-// cost. Returns ErrUnsolvable if no solvable combination exists.
-func bestCombination(s Solver, a *Authorization) ([]protocol.Challenge, error) {
+// cost, ignoring combinations whose key is in exclude. Returns
+// ErrUnsolvable if no solvable combination exists.
+func bestCombination(s Solver, a *Authorization, exclude map[string]bool) ([]protocol.Challenge, error) {
 	var errs []error
 	var ret []protocol.Challenge
 	bestCost := math.Inf(1)
@@ -162,6 +556,9 @@ func bestCombination(s Solver, a *Authorization) ([]protocol.Challenge, error) {
 		for _, ci := range cis {
 			cs = append(cs, a.Challenges[ci])
 		}
+		if exclude[combinationKey(cs)] {
+			continue
+		}
 		cost, err := s.Cost(cs)
 		if err != nil {
 			errs = append(errs, err)
@@ -185,12 +582,33 @@ func bestCombination(s Solver, a *Authorization) ([]protocol.Challenge, error) {
 	return ret, nil
 }
 
-// startSolver instantiates the solver and informs the ACME server.
-func (ci *CertificateIssuer) startSolver(s Solver, cs []protocol.Challenge) (func() error, error) {
-	resps, stop, err := s.Solve(cs)
+// combinationKey returns a string identifying the challenge types of
+// a combination. The same types in a new authorization yield the
+// same key.
+func combinationKey(cs []protocol.Challenge) string {
+	var ts []string
+	for _, c := range cs {
+		ts = append(ts, string(c.GetType()))
+	}
+	sort.Strings(ts)
+	return strings.Join(ts, ", ")
+}
+
+// startSolver instantiates the solver, runs any self-check and
+// informs the ACME server. Challenges the server immediately rejects
+// are not treated as errors; the failure is picked up by
+// waitAuthorizations.
+func (ci *CertificateIssuer) startSolver(s Solver, ids []Identifier, cs []protocol.Challenge) (func() error, error) {
+	resps, solverStop, err := solve(s, ids, cs, ci.cancel)
 	if err != nil {
 		return nil, err
 	}
+	ci.emit(&SolverStartedEvent{Identifiers: ids, Challenges: cs})
+	stop := func() error {
+		err := solverStop()
+		ci.emit(&SolverStoppedEvent{Identifiers: ids, Challenges: cs, Err: err})
+		return err
+	}
 	errStop := stop
 	defer func() {
 		errStop()
@@ -200,54 +618,149 @@ func (ci *CertificateIssuer) startSolver(s Solver, cs []protocol.Challenge) (fun
 		return nil, fmt.Errorf("solver was given %d challenges, but returned %d responses (the solver code is broken)", len(cs), len(resps))
 	}
 
+	if ci.selfCheck != nil {
+		for i, ch := range cs {
+			if ci.isCanceled() {
+				return nil, ErrCanceled
+			}
+
+			if err := ci.selfCheck.SelfCheck(ids[i], ch, resps[i]); err != nil {
+				return nil, &SelfCheckError{Identifier: ids[i], Type: ch.GetType(), Err: err}
+			}
+		}
+	}
+
 	// Tell the ACME server the challenge was accepted.
 	for i, ch := range cs {
 		if ci.isCanceled() {
 			return nil, ErrCanceled
 		}
 
-		ch, err = ci.ia.ValidateChallenge(ch.GetURI(), resps[i])
+		vch, err := ci.ia.ValidateChallenge(ch.GetURI(), resps[i])
 		if err != nil {
 			return nil, err
 		}
-		if ch.GetStatus() == protocol.StatusInvalid {
-			return nil, fmt.Errorf("challenge validation failed: %+v", ch)
-		}
+		ci.emit(&ChallengeStatusEvent{Identifier: ids[i], Challenge: vch})
 	}
 
 	errStop = func() error { return nil }
 	return stop, nil
 }
 
-// waitAuthorizations waits for authorization requests to complete.
-func (ci *CertificateIssuer) waitAuthorizations(as []*Authorization) error {
-	// It doesn't matter in which order we do this since all of
-	// them must complete. So we think of rem as a stack, for
-	// simplicity.
-	for len(as) != 0 {
-		if ci.isCanceled() {
-			return ErrCanceled
-		}
-
-		a, err := ci.ia.Authorization(as[len(as)-1].URI)
+// waitAuthorizations waits for authorization requests to
+// complete. The returned slice has the final state of each
+// authorization that became invalid, at the same index as in as,
+// and nil for those that became valid.
+func (ci *CertificateIssuer) waitAuthorizations(as []*Authorization) ([]*Authorization, error) {
+	invalid := make([]*Authorization, len(as))
+	err := ci.parallel(len(as), func(i int, quit <-chan struct{}) error {
+		a, err := ci.waitAuthorization(as[i], quit)
 		if err != nil {
 			return err
 		}
-		switch a.Status {
-		case protocol.StatusValid:
-			as = as[:len(as)-1]
-			a.RetryAfter = 0
+		if a.Status == protocol.StatusInvalid {
+			invalid[i] = a
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		case protocol.StatusInvalid:
-			return fmt.Errorf("authorization validation failed: %+v", a)
+	return invalid, nil
+}
+
+// waitAuthorization polls an authorization until it is valid or
+// invalid, and returns the final state.
+func (ci *CertificateIssuer) waitAuthorization(a *Authorization, quit <-chan struct{}) (*Authorization, error) {
+	// Challenge status by URI, for reporting changes.
+	seen := map[string]protocol.Status{}
+	for _, c := range a.Challenges {
+		seen[c.GetURI()] = c.GetStatus()
+	}
+
+	for {
+		na, err := ci.ia.Authorization(a.URI)
+		if err != nil {
+			return nil, err
+		}
+		if na.Identifier == nil {
+			na.Identifier = a.Identifier
+		}
+		for _, c := range na.Challenges {
+			if st, ok := seen[c.GetURI()]; !ok || st != c.GetStatus() {
+				seen[c.GetURI()] = c.GetStatus()
+				ci.emit(&ChallengeStatusEvent{Identifier: a.Identifier, Challenge: c})
+			}
+		}
+		switch na.Status {
+		case protocol.StatusValid, protocol.StatusInvalid:
+			na.RetryAfter = 0
+			ci.emit(&AuthorizationDoneEvent{Authorization: na})
+			return na, nil
 		}
+		ci.emit(&AuthorizationPollEvent{Authorization: na, Wait: na.RetryAfter})
 
 		select {
-		case <-time.After(a.RetryAfter):
+		case <-time.After(na.RetryAfter):
 			break
 
+		case <-quit:
+			return nil, errQuit
+
 		case <-ci.cancel:
-			return ErrCanceled
+			return nil, ErrCanceled
+		}
+	}
+}
+
+// errQuit is returned from functions given to parallel when they
+// stop because another call failed. It is never returned by parallel.
+var errQuit = errors.New("quit")
+
+// parallel calls fn for each index in [0, n), with at most
+// ci.concurrency calls running at the same time. When a call fails,
+// no new calls are started and the quit channel is closed. Returns
+// the error of the lowest failing index, or ErrCanceled if the
+// issuer was canceled.
+func (ci *CertificateIssuer) parallel(n int, fn func(i int, quit <-chan struct{}) error) error {
+	errs := make([]error, n)
+	quit := make(chan struct{})
+	var quitOnce sync.Once
+	sem := make(chan struct{}, ci.concurrency)
+	var wg sync.WaitGroup
+
+loop:
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+			break
+
+		case <-quit:
+			break loop
+		}
+		if ci.isCanceled() {
+			errs[i] = ErrCanceled
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := fn(i, quit); err != nil {
+				errs[i] = err
+				quitOnce.Do(func() { close(quit) })
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil && err != errQuit {
+			return err
 		}
 	}
 
@@ -255,7 +768,8 @@ func (ci *CertificateIssuer) waitAuthorizations(as []*Authorization) error {
 }
 
 // Cancel stops any running invocation of AuthorizeAndIssue and causes
-// new invocations to fail early. A canceled issuer should not be reused.
+// new invocations to fail early. This includes all jobs. A canceled
+// issuer should not be reused.
 func (ci *CertificateIssuer) Cancel() {
 	close(ci.cancel)
 }
@@ -280,8 +794,26 @@ type IssuingAccount interface {
 	IssueCertificate(csr []byte) (*Certificate, error)
 }
 
+// A CertificateGetter can fetch certificates by URI, e.g. issuer
+// certificates. A ClientAccount fulfills this interface.
+type CertificateGetter interface {
+	Certificate(uri string) (*Certificate, error)
+}
+
+// A ReplacingAccount is an IssuingAccount that can issue a
+// certificate replacing an earlier one. A ClientAccount fulfills this
+// interface.
+type ReplacingAccount interface {
+	IssuingAccount
+	ReplaceCertificate(csr []byte, certID string) (*Certificate, error)
+}
+
 // Solver is a way to produce responses to one or more
 // challenges. Solver object functions must be concurrency-safe.
+//
+// Some solvers need the identifier each challenge authorizes. They
+// implement IdentifierSolver, and their Solve returns
+// ErrNeedIdentifiers.
 type Solver interface {
 	// Cost describes the cost to solve the set of challenges. The
 	// returned cost is a number in some (consistent) unit. It
@@ -299,3 +831,43 @@ type Solver interface {
 	// If err != nil, the stop function must not be called.
 	Solve([]protocol.Challenge) (resps []protocol.Response, stop func() error, err error)
 }
+
+// An IdentifierSolver is a Solver that also needs the identifier
+// each challenge authorizes, e.g. because dns-01 publishes its
+// record under the identifier's name. Its Solve returns
+// ErrNeedIdentifiers, so callers holding a Solver must check for
+// this interface and call SolveIdentifiers. CertificateIssuer does,
+// as does TypeSolver.SolveIdentifiers.
+type IdentifierSolver interface {
+	Solver
+
+	// SolveIdentifiers is like Solve, but ids[i] is the
+	// identifier being authorized by cs[i].
+	SolveIdentifiers(ids []Identifier, cs []protocol.Challenge) (resps []protocol.Response, stop func() error, err error)
+}
+
+// A CancelableSolver is an IdentifierSolver that can take long to
+// start, e.g. because it waits for DNS propagation. CertificateIssuer
+// calls SolveIdentifiersCancel, so canceling the issuer or job
+// interrupts it.
+type CancelableSolver interface {
+	IdentifierSolver
+
+	// SolveIdentifiersCancel is like SolveIdentifiers, but
+	// returns ErrCanceled soon after cancel is closed. A nil
+	// cancel is never closed.
+	SolveIdentifiersCancel(ids []Identifier, cs []protocol.Challenge, cancel <-chan struct{}) (resps []protocol.Response, stop func() error, err error)
+}
+
+// solve starts the solver, passing the identifiers if it is an
+// IdentifierSolver, and cancel if it is a CancelableSolver.
+func solve(s Solver, ids []Identifier, cs []protocol.Challenge, cancel <-chan struct{}) ([]protocol.Response, func() error, error) {
+	switch s := s.(type) {
+	case CancelableSolver:
+		return s.SolveIdentifiersCancel(ids, cs, cancel)
+	case IdentifierSolver:
+		return s.SolveIdentifiers(ids, cs)
+	default:
+		return s.Solve(cs)
+	}
+}
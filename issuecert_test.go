@@ -4,11 +4,14 @@ import (
 	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"errors"
 	"fmt"
 	"reflect"
-	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/tommie/acme-go/protocol"
 )
@@ -35,7 +38,6 @@ func TestCertificateIssuerAuthorizeAndIssue(t *testing.T) {
 	if want := (&Certificate{URI: "http://example.com/cert/4"}); !reflect.DeepEqual(got, want) {
 		t.Errorf("AuthorizeAndIssue: got %v, want %v", got, want)
 	}
-	sort.Strings(ids)
 	if want := []string{"dns:a.example.com", "dns:b.example.com"}; !reflect.DeepEqual(ids, want) {
 		t.Errorf("AuthorizeAndIssue ids: got %v, want %v", ids, want)
 	}
@@ -57,6 +59,218 @@ func TestCertificateIssuerCancel(t *testing.T) {
 	}
 }
 
+func TestCertificateIssuerCancelSolver(t *testing.T) {
+	s := &stubCancelableSolver{
+		stubIdentifierSolver: stubIdentifierSolver{stubSolver: stubSolver{
+			costs: map[protocol.ChallengeType]float64{protocol.ChallengeDNS01: 1},
+		}},
+		started: make(chan struct{}),
+	}
+	ia := &stubIssuingAccount{
+		authzID: func(id Identifier) (*Authorization, error) {
+			return testPendingAuthorization("/authz/1", id), nil
+		},
+	}
+
+	ci := NewCertificateIssuer(ia)
+	go func() {
+		<-s.started
+		ci.Cancel()
+	}()
+	_, err := ci.AuthorizeAndIssue(testCSR, TypeSolver{protocol.ChallengeDNS01: s})
+	if err != ErrCanceled {
+		t.Fatalf("AuthorizeAndIssue error: got %v, want %v", err, ErrCanceled)
+	}
+}
+
+func TestCertificateIssuerAuthorizeFallback(t *testing.T) {
+	s := &stubSolver{
+		costs: map[protocol.ChallengeType]float64{protocol.ChallengeHTTP01: 1, protocol.ChallengeDNS01: 2},
+		resps: map[protocol.ChallengeType]protocol.Response{
+			protocol.ChallengeHTTP01: &protocol.HTTP01Response{Type: protocol.ChallengeHTTP01},
+			protocol.ChallengeDNS01:  &protocol.DNS01Response{Type: protocol.ChallengeDNS01},
+		},
+	}
+	tsts := []struct {
+		name   string
+		status map[string]protocol.Status
+
+		wantURIs     []string
+		wantAttempts int
+		err          error
+	}{
+		{
+			name:   "first",
+			status: map[string]protocol.Status{"/authz/1": protocol.StatusValid},
+
+			wantURIs: []string{"/authz/1/0"},
+		},
+		{
+			name: "second",
+			status: map[string]protocol.Status{
+				"/authz/1": protocol.StatusInvalid,
+				"/authz/2": protocol.StatusValid,
+			},
+
+			wantURIs: []string{"/authz/1/0", "/authz/2/1"},
+		},
+		{
+			name: "exhausted",
+			status: map[string]protocol.Status{
+				"/authz/1": protocol.StatusInvalid,
+				"/authz/2": protocol.StatusInvalid,
+			},
+
+			wantURIs:     []string{"/authz/1/0", "/authz/2/1"},
+			wantAttempts: 2,
+			err:          ErrAuthorizationFailed,
+		},
+	}
+
+	for _, tst := range tsts {
+		var uris []string
+		ia := &stubIssuingAccount{
+			authzID: func(id Identifier) (*Authorization, error) {
+				return testPendingAuthorization("/authz/2", id), nil
+			},
+			authz: func(uri string) (*Authorization, error) {
+				return &Authorization{URI: uri, Status: tst.status[uri]}, nil
+			},
+			validate: func(uri string, resp protocol.Response) (protocol.Challenge, error) {
+				uris = append(uris, uri)
+				return &protocol.GenericChallenge{Type: resp.GetType(), Status: protocol.StatusPending}, nil
+			},
+		}
+		as := []*Authorization{testPendingAuthorization("/authz/1", DNSIdentifier("a.example.com"))}
+		err := NewCertificateIssuer(ia).authorize(s, as)
+		if tst.err == nil {
+			if err != nil {
+				t.Errorf("[%s] authorize failed: %v", tst.name, err)
+			}
+		} else if aerr, ok := err.(*AuthorizationError); !ok || aerr.Err != tst.err {
+			t.Errorf("[%s] authorize error: got %v, want %v", tst.name, err, tst.err)
+		} else if len(aerr.Attempts) != tst.wantAttempts {
+			t.Errorf("[%s] authorize attempts: got %v, want %v", tst.name, len(aerr.Attempts), tst.wantAttempts)
+		}
+		if !reflect.DeepEqual(uris, tst.wantURIs) {
+			t.Errorf("[%s] authorize challenge URIs: got %v, want %v", tst.name, uris, tst.wantURIs)
+		}
+	}
+}
+
+func TestCertificateIssuerAuthorizeUnsolvableRetry(t *testing.T) {
+	s := &stubSolver{
+		costs: map[protocol.ChallengeType]float64{protocol.ChallengeHTTP01: 1, protocol.ChallengeDNS01: 2},
+		resps: map[protocol.ChallengeType]protocol.Response{
+			protocol.ChallengeHTTP01: &protocol.HTTP01Response{Type: protocol.ChallengeHTTP01},
+			protocol.ChallengeDNS01:  &protocol.DNS01Response{Type: protocol.ChallengeDNS01},
+		},
+	}
+	ids := map[string]Identifier{
+		"/authz/1": DNSIdentifier("a.example.com"),
+		"/authz/2": DNSIdentifier("b.example.com"),
+		"/authz/3": DNSIdentifier("b.example.com"),
+	}
+	ia := &stubIssuingAccount{
+		authzID: func(id Identifier) (*Authorization, error) {
+			// Only offers the http-01 challenge that already failed.
+			a := testPendingAuthorization("/authz/3", id)
+			a.Combinations = [][]int{{0}}
+			return a, nil
+		},
+		authz: func(uri string) (*Authorization, error) {
+			return &Authorization{URI: uri, Status: protocol.StatusInvalid, Identifier: ids[uri]}, nil
+		},
+		validate: func(uri string, resp protocol.Response) (protocol.Challenge, error) {
+			return &protocol.GenericChallenge{Type: resp.GetType(), Status: protocol.StatusPending}, nil
+		},
+	}
+	exhausted := testPendingAuthorization("/authz/1", DNSIdentifier("a.example.com"))
+	exhausted.Combinations = [][]int{{0}}
+	as := []*Authorization{
+		exhausted,
+		testPendingAuthorization("/authz/2", DNSIdentifier("b.example.com")),
+	}
+	err := NewCertificateIssuer(ia).authorize(s, as)
+	aerr, ok := err.(*AuthorizationError)
+	if !ok || !errors.Is(aerr.Err, ErrUnsolvable) {
+		t.Fatalf("authorize error: got %v, want %v", err, ErrUnsolvable)
+	}
+	var got []string
+	for _, a := range aerr.Authorizations {
+		got = append(got, a.URI)
+	}
+	if want := []string{"/authz/1", "/authz/3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("authorize error authorizations: got %v, want %v", got, want)
+	}
+	if len(aerr.Attempts) != 2 {
+		t.Errorf("authorize attempts: got %v, want %v", len(aerr.Attempts), 2)
+	}
+}
+
+// testPendingAuthorization returns a pending authorization offering
+// http-01 and dns-01, with URIs based on uri.
+func testPendingAuthorization(uri string, id Identifier) *Authorization {
+	return &Authorization{
+		Authorization: protocol.Authorization{
+			Challenges: []protocol.Challenge{
+				&protocol.HTTP01Challenge{Type: protocol.ChallengeHTTP01, URI: uri + "/0"},
+				&protocol.DNS01Challenge{Type: protocol.ChallengeDNS01, URI: uri + "/1"},
+			},
+			Combinations: [][]int{{0}, {1}},
+		},
+		Status:     protocol.StatusPending,
+		Identifier: id,
+		URI:        uri,
+	}
+}
+
+func TestAuthorizationError(t *testing.T) {
+	tried := testPendingAuthorization("/authz/1", DNSIdentifier("a.example.com"))
+	final := testPendingAuthorization("/authz/1", DNSIdentifier("a.example.com"))
+	final.Status = protocol.StatusInvalid
+	final.Challenges[0] = &protocol.HTTP01Challenge{
+		Type:   protocol.ChallengeHTTP01,
+		URI:    "/authz/1/0",
+		Status: protocol.StatusInvalid,
+		Error:  &protocol.Problem{Type: protocol.ConnectionError, Detail: "connection refused"},
+	}
+	err := &AuthorizationError{
+		Err:            ErrAuthorizationFailed,
+		Authorizations: []*Authorization{final},
+		Attempts: []*AuthorizationAttempt{
+			{Authorization: final, Challenges: tried.Challenges[:1]},
+		},
+	}
+
+	if !errors.Is(err, ErrAuthorizationFailed) {
+		t.Errorf("Is: got false, want true")
+	}
+	if got, want := err.Identifiers(), []Identifier{DNSIdentifier("a.example.com")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Identifiers: got %v, want %v", got, want)
+	}
+
+	want := []*ChallengeFailure{
+		{
+			Identifier: DNSIdentifier("a.example.com"),
+			Type:       protocol.ChallengeHTTP01,
+			URI:        "/authz/1/0",
+			Status:     protocol.StatusInvalid,
+			Problem:    &protocol.Problem{Type: protocol.ConnectionError, Detail: "connection refused"},
+		},
+	}
+	if got := err.Failures(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Failures: got %+v, want %+v", got, want)
+	}
+
+	if got, want := err.Error(), "dns:a.example.com http-01: connection refused (urn:acme:error:connection)"; !strings.Contains(got, want) {
+		t.Errorf("Error: got %q, want containing %q", got, want)
+	}
+	if got, want := err.Remediation(), "Check that a.example.com is reachable from the Internet for http-01"; !strings.Contains(got, want) {
+		t.Errorf("Remediation: got %q, want containing %q", got, want)
+	}
+}
+
 func TestCertificateIssuerAuthorizeIdentitiesPending(t *testing.T) {
 	ia := &stubIssuingAccount{
 		authzID: func(id Identifier) (*Authorization, error) {
@@ -75,7 +289,6 @@ func TestCertificateIssuerAuthorizeIdentitiesPending(t *testing.T) {
 	if err != nil {
 		t.Fatalf("authorizeIdentities failed: %v", err)
 	}
-	sort.Sort(byIdentifier(got))
 	want := []*Authorization{
 		&Authorization{
 			Authorization: protocol.Authorization{
@@ -131,6 +344,81 @@ func TestCertificateIssuerAuthorizeIdentitiesInvalid(t *testing.T) {
 	}
 }
 
+func TestCertificateIssuerAuthorizeIDsConcurrency(t *testing.T) {
+	var ids []Identifier
+	for i := 0; i < 16; i++ {
+		ids = append(ids, DNSIdentifier(fmt.Sprintf("%d.example.com", i)))
+	}
+
+	tsts := []struct {
+		name        string
+		concurrency int
+		fail        map[string]bool
+
+		want []string
+		err  error
+	}{
+		{
+			name:        "sequential",
+			concurrency: 1,
+
+			want: []string{"dns:0.example.com", "dns:15.example.com"},
+		},
+		{
+			name:        "parallel",
+			concurrency: 4,
+
+			want: []string{"dns:0.example.com", "dns:15.example.com"},
+		},
+		{
+			name:        "error",
+			concurrency: 4,
+			fail:        map[string]bool{"dns:3.example.com": true, "dns:5.example.com": true},
+
+			err: fmt.Errorf(`authorization invalid for "dns:3.example.com"`),
+		},
+	}
+
+	for _, tst := range tsts {
+		var running, maxRunning int32
+		ia := &stubIssuingAccount{
+			authzID: func(id Identifier) (*Authorization, error) {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					m := atomic.LoadInt32(&maxRunning)
+					if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+
+				if tst.fail[id.String()] {
+					return &Authorization{Status: protocol.StatusInvalid}, nil
+				}
+				return &Authorization{Status: protocol.StatusPending, Identifier: id}, nil
+			},
+		}
+
+		got, err := NewCertificateIssuer(ia, WithConcurrency(tst.concurrency)).authorizeIDs(ids)
+		if !matchError(err, tst.err) {
+			t.Errorf("[%s] authorizeIDs failed: got %v, want prefix %v", tst.name, err, tst.err)
+		}
+		if err != nil {
+			continue
+		}
+		if maxRunning > int32(tst.concurrency) {
+			t.Errorf("[%s] authorizeIDs concurrency: got %v, want at most %v", tst.name, maxRunning, tst.concurrency)
+		}
+		if len(got) != len(ids) {
+			t.Fatalf("[%s] authorizeIDs: got %d authorizations, want %d", tst.name, len(got), len(ids))
+		}
+		if gotIDs := []string{got[0].Identifier.String(), got[len(got)-1].Identifier.String()}; !reflect.DeepEqual(gotIDs, tst.want) {
+			t.Errorf("[%s] authorizeIDs order: got %v, want %v", tst.name, gotIDs, tst.want)
+		}
+	}
+}
+
 func TestBestCombination(t *testing.T) {
 	s := &stubSolver{
 		costs: map[protocol.ChallengeType]float64{protocol.ChallengeDNS01: 2, protocol.ChallengeHTTP01: 1},
@@ -197,7 +485,7 @@ func TestBestCombination(t *testing.T) {
 	}
 
 	for _, tst := range tsts {
-		got, err := bestCombination(s, &tst.authz)
+		got, err := bestCombination(s, &tst.authz, nil)
 		if !matchError(err, tst.err) {
 			t.Errorf("[%s] bestCombination ok: got %v, want prefix %v", tst.name, err, tst.err)
 		}
@@ -217,9 +505,10 @@ func TestCertificateIssuerStartSolver(t *testing.T) {
 		URI:  "/chal/5",
 	}
 	tsts := []struct {
-		name   string
-		cs     []protocol.Challenge
-		status protocol.Status
+		name      string
+		cs        []protocol.Challenge
+		status    protocol.Status
+		selfCheck SelfChecker
 
 		wantURIs []string
 		err      error
@@ -244,8 +533,22 @@ func TestCertificateIssuerStartSolver(t *testing.T) {
 			cs:     []protocol.Challenge{dns01Challenge},
 			status: protocol.StatusInvalid,
 
+			// Picked up by waitAuthorizations.
 			wantURIs: []string{"/chal/5"},
-			err:      fmt.Errorf("challenge validation failed"),
+		},
+		{
+			name:      "self-check ok",
+			cs:        []protocol.Challenge{dns01Challenge},
+			selfCheck: stubSelfChecker{},
+
+			wantURIs: []string{"/chal/5"},
+		},
+		{
+			name:      "self-check failed",
+			cs:        []protocol.Challenge{dns01Challenge},
+			selfCheck: stubSelfChecker{errors.New("mock error")},
+
+			err: fmt.Errorf("self-check of dns-01"),
 		},
 	}
 
@@ -257,7 +560,7 @@ func TestCertificateIssuerStartSolver(t *testing.T) {
 				return &protocol.GenericChallenge{Type: resp.GetType(), Status: tst.status}, nil
 			},
 		}
-		_, err := NewCertificateIssuer(ia).startSolver(s, tst.cs)
+		_, err := NewCertificateIssuer(ia, WithSelfCheck(tst.selfCheck)).startSolver(s, make([]Identifier, len(tst.cs)), tst.cs)
 		if !matchError(err, tst.err) {
 			t.Errorf("[%s] startSolvers failed: got %v, want prefix %v", tst.name, err, tst.err)
 		}
@@ -267,14 +570,35 @@ func TestCertificateIssuerStartSolver(t *testing.T) {
 	}
 }
 
+func TestCertificateIssuerStartSolverIdentifiers(t *testing.T) {
+	s := &stubIdentifierSolver{stubSolver: stubSolver{
+		resps: map[protocol.ChallengeType]protocol.Response{protocol.ChallengeDNS01: &protocol.DNS01Response{Type: protocol.ChallengeDNS01}},
+	}}
+	ia := &stubIssuingAccount{
+		validate: func(uri string, resp protocol.Response) (protocol.Challenge, error) {
+			return &protocol.GenericChallenge{Type: resp.GetType(), Status: protocol.StatusPending}, nil
+		},
+	}
+	ids := []Identifier{DNSIdentifier("a.example.com")}
+	cs := []protocol.Challenge{&protocol.DNS01Challenge{Type: protocol.ChallengeDNS01, URI: "/chal/5"}}
+
+	if _, err := NewCertificateIssuer(ia).startSolver(s, ids, cs); err != nil {
+		t.Fatalf("startSolver failed: %v", err)
+	}
+	if !reflect.DeepEqual(s.ids, ids) {
+		t.Errorf("startSolver ids: got %v, want %v", s.ids, ids)
+	}
+}
+
 func TestCertificateIssuerWaitAuthorizations(t *testing.T) {
 	tsts := []struct {
 		name string
 		as   []*Authorization
 		sm   map[string][]protocol.Status
 
-		wantURIs []string
-		err      error
+		wantURIs    []string
+		wantInvalid []bool
+		err         error
 	}{
 		{
 			name: "empty",
@@ -288,7 +612,8 @@ func TestCertificateIssuerWaitAuthorizations(t *testing.T) {
 				"/authz/2": []protocol.Status{protocol.StatusValid},
 			},
 
-			wantURIs: []string{"/authz/2"},
+			wantURIs:    []string{"/authz/2"},
+			wantInvalid: []bool{false},
 		},
 		{
 			name: "invalid",
@@ -299,8 +624,8 @@ func TestCertificateIssuerWaitAuthorizations(t *testing.T) {
 				"/authz/2": []protocol.Status{protocol.StatusInvalid},
 			},
 
-			wantURIs: []string{"/authz/2"},
-			err:      fmt.Errorf("authorization validation failed:"),
+			wantURIs:    []string{"/authz/2"},
+			wantInvalid: []bool{true},
 		},
 		{
 			name: "pending",
@@ -311,7 +636,8 @@ func TestCertificateIssuerWaitAuthorizations(t *testing.T) {
 				"/authz/2": []protocol.Status{protocol.StatusPending, protocol.StatusValid},
 			},
 
-			wantURIs: []string{"/authz/2", "/authz/2"},
+			wantURIs:    []string{"/authz/2", "/authz/2"},
+			wantInvalid: []bool{false},
 		},
 		{
 			name: "valid-pending",
@@ -324,7 +650,8 @@ func TestCertificateIssuerWaitAuthorizations(t *testing.T) {
 				"/authz/3": []protocol.Status{protocol.StatusValid},
 			},
 
-			wantURIs: []string{"/authz/3", "/authz/2", "/authz/2"},
+			wantURIs:    []string{"/authz/2", "/authz/2", "/authz/3"},
+			wantInvalid: []bool{false, false},
 		},
 	}
 
@@ -338,10 +665,17 @@ func TestCertificateIssuerWaitAuthorizations(t *testing.T) {
 				return &Authorization{Status: tst.sm[uri][counts[uri]-1]}, nil
 			},
 		}
-		err := NewCertificateIssuer(ia).waitAuthorizations(tst.as)
+		invalid, err := NewCertificateIssuer(ia).waitAuthorizations(tst.as)
 		if !matchError(err, tst.err) {
 			t.Errorf("[%s] waitAuthorizations failed: got %v, want prefix %v", tst.name, err, tst.err)
 		}
+		var gotInvalid []bool
+		for _, a := range invalid {
+			gotInvalid = append(gotInvalid, a != nil)
+		}
+		if !reflect.DeepEqual(gotInvalid, tst.wantInvalid) {
+			t.Errorf("[%s] waitAuthorizations invalid: got %v, want %v", tst.name, gotInvalid, tst.wantInvalid)
+		}
 		if !reflect.DeepEqual(uris, tst.wantURIs) {
 			t.Errorf("[%s] waitAuthorizations uris: got %v, want %v", tst.name, uris, tst.wantURIs)
 		}
@@ -374,6 +708,11 @@ func (ia *stubIssuingAccount) IssueCertificate(csr []byte) (*Certificate, error)
 type stubSolver struct {
 	costs map[protocol.ChallengeType]float64
 	resps map[protocol.ChallengeType]protocol.Response
+	// err is returned from Solve, if set.
+	err error
+
+	// stopped counts calls to stop functions.
+	stopped int32
 }
 
 func (s *stubSolver) Cost(cs []protocol.Challenge) (float64, error) {
@@ -389,6 +728,9 @@ func (s *stubSolver) Cost(cs []protocol.Challenge) (float64, error) {
 }
 
 func (s *stubSolver) Solve(cs []protocol.Challenge) (resps []protocol.Response, stop func() error, err error) {
+	if s.err != nil {
+		return nil, nil, s.err
+	}
 	var ret []protocol.Response
 	for _, c := range cs {
 		resp, ok := s.resps[c.GetType()]
@@ -397,16 +739,46 @@ func (s *stubSolver) Solve(cs []protocol.Challenge) (resps []protocol.Response,
 		}
 		ret = append(ret, resp)
 	}
-	return ret, func() error { return nil }, nil
+	return ret, func() error {
+		atomic.AddInt32(&s.stopped, 1)
+		return nil
+	}, nil
 }
 
-type byIdentifier []*Authorization
+// stubIdentifierSolver is a stubSolver that records the identifiers
+// it was given.
+type stubIdentifierSolver struct {
+	stubSolver
+
+	mu  sync.Mutex
+	ids []Identifier
+}
+
+func (s *stubIdentifierSolver) Solve(cs []protocol.Challenge) ([]protocol.Response, func() error, error) {
+	return nil, nil, ErrNeedIdentifiers
+}
+
+func (s *stubIdentifierSolver) SolveIdentifiers(ids []Identifier, cs []protocol.Challenge) ([]protocol.Response, func() error, error) {
+	s.mu.Lock()
+	s.ids = append(s.ids, ids...)
+	s.mu.Unlock()
+	return s.stubSolver.Solve(cs)
+}
+
+// stubCancelableSolver blocks in SolveIdentifiersCancel until
+// canceled.
+type stubCancelableSolver struct {
+	stubIdentifierSolver
+
+	started     chan struct{}
+	startedOnce sync.Once
+}
 
-func (as byIdentifier) Len() int { return len(as) }
-func (as byIdentifier) Less(i, j int) bool {
-	return as[i].Identifier.String() < as[j].Identifier.String()
+func (s *stubCancelableSolver) SolveIdentifiersCancel(ids []Identifier, cs []protocol.Challenge, cancel <-chan struct{}) ([]protocol.Response, func() error, error) {
+	s.startedOnce.Do(func() { close(s.started) })
+	<-cancel
+	return nil, nil, ErrCanceled
 }
-func (as byIdentifier) Swap(i, j int) { as[i], as[j] = as[j], as[i] }
 
 // matchError returns whether err has pat as a prefix.
 func matchError(err, pat error) bool {
@@ -0,0 +1,163 @@
+package acme
+
+import (
+	"sync"
+)
+
+// JobStatus is the state of a Job.
+type JobStatus int
+
+const (
+	JobRunning JobStatus = iota
+	JobSucceeded
+	JobFailed
+	JobCanceled
+)
+
+func (s JobStatus) String() string {
+	switch s {
+	case JobRunning:
+		return "running"
+	case JobSucceeded:
+		return "succeeded"
+	case JobFailed:
+		return "failed"
+	case JobCanceled:
+		return "canceled"
+	default:
+		return "unknown"
+	}
+}
+
+// A Job is an asynchronous run of AuthorizeAndIssue, started with
+// CertificateIssuer.Start. Its functions are concurrency-safe.
+type Job struct {
+	cancel     chan struct{}
+	cancelOnce sync.Once
+	done       chan struct{}
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	events []Event
+	status JobStatus
+	cert   *Certificate
+	err    error
+}
+
+// Start runs AuthorizeAndIssue in the background. The job can be
+// canceled without affecting other jobs of the issuer, so one issuer
+// can run many jobs concurrently. Canceling the issuer cancels all
+// its jobs.
+func (ci *CertificateIssuer) Start(csr []byte, s Solver) *Job {
+	j := &Job{
+		cancel: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	j.cond = sync.NewCond(&j.mu)
+
+	// A copy of the issuer, with the job's cancel channel and
+	// observer.
+	jci := *ci
+	jci.cancel = j.cancel
+	jci.observer = ObserverFunc(func(e Event) {
+		j.addEvent(e)
+		ci.emit(e)
+	})
+
+	go func() {
+		select {
+		case <-ci.cancel:
+			j.Cancel()
+		case <-j.done:
+		}
+	}()
+
+	go func() {
+		cert, err := jci.AuthorizeAndIssue(csr, s)
+		j.finish(cert, err)
+	}()
+
+	return j
+}
+
+func (j *Job) addEvent(e Event) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.events = append(j.events, e)
+	j.cond.Broadcast()
+}
+
+func (j *Job) finish(cert *Certificate, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.cert = cert
+	j.err = err
+	switch {
+	case err == nil:
+		j.status = JobSucceeded
+	case err == ErrCanceled:
+		j.status = JobCanceled
+	default:
+		j.status = JobFailed
+	}
+	close(j.done)
+	j.cond.Broadcast()
+}
+
+// Status returns the current state of the job.
+func (j *Job) Status() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.status
+}
+
+// Done returns a channel that is closed when the job has finished.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Wait blocks until the job has finished, and returns the result of
+// AuthorizeAndIssue.
+func (j *Job) Wait() (*Certificate, error) {
+	<-j.done
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.cert, j.err
+}
+
+// Cancel stops the job. It is safe to call multiple times, also
+// after the job has finished.
+func (j *Job) Cancel() {
+	j.cancelOnce.Do(func() { close(j.cancel) })
+}
+
+// Events returns a channel with all events of the job, from the
+// start. The channel is closed after the last event, when the job
+// has finished. Each call returns a new channel, and the caller
+// must read it until closed.
+func (j *Job) Events() <-chan Event {
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		for i := 0; ; i++ {
+			j.mu.Lock()
+			for i >= len(j.events) && j.status == JobRunning {
+				j.cond.Wait()
+			}
+			if i >= len(j.events) {
+				j.mu.Unlock()
+				return
+			}
+			e := j.events[i]
+			j.mu.Unlock()
+
+			ch <- e
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,93 @@
+package acme
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tommie/acme-go/protocol"
+)
+
+func TestCertificateIssuerStart(t *testing.T) {
+	ia := &stubIssuingAccount{
+		authzID: func(id Identifier) (*Authorization, error) {
+			return &Authorization{Status: protocol.StatusValid}, nil
+		},
+		issue: func(csr []byte) (*Certificate, error) {
+			return &Certificate{URI: "http://example.com/cert/4"}, nil
+		},
+	}
+
+	j := NewCertificateIssuer(ia).Start(testCSR, &stubSolver{})
+	var got []Event
+	for e := range j.Events() {
+		got = append(got, e)
+	}
+
+	cert, err := j.Wait()
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if want := (&Certificate{URI: "http://example.com/cert/4"}); !reflect.DeepEqual(cert, want) {
+		t.Errorf("Wait: got %v, want %v", cert, want)
+	}
+	if st := j.Status(); st != JobSucceeded {
+		t.Errorf("Status: got %v, want %v", st, JobSucceeded)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Events: got %v, want 3 events", got)
+	}
+	if _, ok := got[2].(*IssuedEvent); !ok {
+		t.Errorf("Events: got %T, want %T", got[2], &IssuedEvent{})
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	polled := make(chan struct{}, 1)
+	ia := &stubIssuingAccount{
+		authzID: func(id Identifier) (*Authorization, error) {
+			return testPendingAuthorization("/authz/"+id.String(), id), nil
+		},
+		authz: func(uri string) (*Authorization, error) {
+			select {
+			case polled <- struct{}{}:
+			default:
+			}
+			return &Authorization{URI: uri, Status: protocol.StatusPending, RetryAfter: time.Hour}, nil
+		},
+		validate: func(uri string, resp protocol.Response) (protocol.Challenge, error) {
+			return &protocol.GenericChallenge{Type: resp.GetType(), Status: protocol.StatusPending}, nil
+		},
+	}
+	s := &stubSolver{
+		costs: map[protocol.ChallengeType]float64{protocol.ChallengeHTTP01: 1},
+		resps: map[protocol.ChallengeType]protocol.Response{
+			protocol.ChallengeHTTP01: &protocol.HTTP01Response{Type: protocol.ChallengeHTTP01},
+		},
+	}
+	ci := NewCertificateIssuer(ia)
+
+	j := ci.Start(testCSR, s)
+	<-polled
+	j.Cancel()
+	if _, err := j.Wait(); err != ErrCanceled {
+		t.Errorf("Wait: got %v, want %v", err, ErrCanceled)
+	}
+	if st := j.Status(); st != JobCanceled {
+		t.Errorf("Status: got %v, want %v", st, JobCanceled)
+	}
+	if s.stopped != 1 {
+		t.Errorf("Wait stopped: got %v, want 1", s.stopped)
+	}
+
+	// The issuer is still usable.
+	if ci.isCanceled() {
+		t.Errorf("isCanceled: got true, want false")
+	}
+	j2 := ci.Start(testCSR, s)
+	<-polled
+	ci.Cancel()
+	if _, err := j2.Wait(); err != ErrCanceled {
+		t.Errorf("Wait (issuer canceled): got %v, want %v", err, ErrCanceled)
+	}
+}
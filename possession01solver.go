@@ -0,0 +1,136 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/tommie/acme-go/protocol"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// A CertificateKey is a previously issued certificate and its
+// private key.
+type CertificateKey struct {
+	// Certificate is the DER-encoded X.509 certificate.
+	Certificate []byte
+
+	// Key is the private key of the certificate.
+	Key crypto.Signer
+}
+
+// A Possession01Solver is a Solver for proofOfPossession-01
+// challenges. It signs the validation object with the key of a
+// certificate we already hold, if the server accepts any of them.
+// This allows re-authorizing identifiers without touching DNS or
+// HTTP.
+type Possession01Solver struct {
+	accountKey *jose.JSONWebKey
+	keys       []crypto.Signer
+	cost       float64
+}
+
+// NewPossession01Solver creates a solver from a set of certificates
+// and their keys. The public part of the account key is included in
+// the signed validation object. The cost is per challenge.
+func NewPossession01Solver(accountKey *jose.JSONWebKey, cost float64, cks ...CertificateKey) (*Possession01Solver, error) {
+	pub := accountKey.Public()
+	s := &Possession01Solver{
+		accountKey: &pub,
+		cost:       cost,
+	}
+	for _, ck := range cks {
+		cert, err := x509.ParseCertificate(ck.Certificate)
+		if err != nil {
+			return nil, err
+		}
+		if !publicKeysEqual(cert.PublicKey, ck.Key.Public()) {
+			return nil, fmt.Errorf("certificate key mismatch for %q", cert.Subject.CommonName)
+		}
+		s.keys = append(s.keys, ck.Key)
+	}
+
+	return s, nil
+}
+
+func (s *Possession01Solver) Cost(cs []protocol.Challenge) (float64, error) {
+	for _, c := range cs {
+		pc, ok := c.(*protocol.Possession01Challenge)
+		if !ok {
+			return 0, ErrUnsolvable
+		}
+		if _, err := s.findKey(pc); err != nil {
+			return 0, err
+		}
+	}
+
+	return s.cost * float64(len(cs)), nil
+}
+
+// Solve returns ErrNeedIdentifiers. Use SolveIdentifiers.
+func (s *Possession01Solver) Solve(cs []protocol.Challenge) ([]protocol.Response, func() error, error) {
+	return nil, nil, ErrNeedIdentifiers
+}
+
+func (s *Possession01Solver) SolveIdentifiers(ids []Identifier, cs []protocol.Challenge) ([]protocol.Response, func() error, error) {
+	var resps []protocol.Response
+	for i, c := range cs {
+		pc, ok := c.(*protocol.Possession01Challenge)
+		if !ok {
+			return nil, nil, ErrUnsolvable
+		}
+		key, err := s.findKey(pc)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sk, _, err := signingKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		signer, err := jose.NewSigner(sk, &jose.SignerOptions{EmbedJWK: true})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		resp, err := protocol.RespondPossession01(signer, &protocol.Possession01Validation{
+			Type:        pc.Type,
+			Identifiers: []protocol.Identifier{*ids[i].Protocol()},
+			AccountKey:  *s.accountKey,
+		}, pc)
+		if err != nil {
+			return nil, nil, err
+		}
+		resps = append(resps, resp)
+	}
+
+	return resps, func() error { return nil }, nil
+}
+
+// findKey returns a key we hold for any of the certificates in the
+// challenge. Returns ErrUnsolvable if there is none.
+func (s *Possession01Solver) findKey(c *protocol.Possession01Challenge) (crypto.Signer, error) {
+	for _, der := range c.Certs {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			// Other certificates may still be usable.
+			continue
+		}
+		for _, key := range s.keys {
+			if publicKeysEqual(cert.PublicKey, key.Public()) {
+				return key, nil
+			}
+		}
+	}
+
+	return nil, ErrUnsolvable
+}
+
+// publicKeysEqual returns whether two public keys are the same.
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	type equaler interface {
+		Equal(crypto.PublicKey) bool
+	}
+	ae, ok := a.(equaler)
+	return ok && ae.Equal(b)
+}
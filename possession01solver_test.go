@@ -0,0 +1,114 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tommie/acme-go/protocol"
+)
+
+func TestPossession01SolverCost(t *testing.T) {
+	ck := mustGenerateCertificateKey("a.example.com")
+	other := mustGenerateCertificateKey("b.example.com")
+	s, err := NewPossession01Solver(testJWK, 0.5, ck)
+	if err != nil {
+		t.Fatalf("NewPossession01Solver failed: %v", err)
+	}
+
+	got, err := s.Cost([]protocol.Challenge{possession01Challenge(other, ck)})
+	if err != nil {
+		t.Fatalf("Cost failed: %v", err)
+	}
+	if want := 0.5; got != want {
+		t.Errorf("Cost: got %v, want %v", got, want)
+	}
+
+	if _, err := s.Cost([]protocol.Challenge{possession01Challenge(other)}); err != ErrUnsolvable {
+		t.Errorf("Cost(other): got %v, want %v", err, ErrUnsolvable)
+	}
+	if _, err := s.Cost([]protocol.Challenge{&protocol.HTTP01Challenge{Type: protocol.ChallengeHTTP01}}); err != ErrUnsolvable {
+		t.Errorf("Cost(http-01): got %v, want %v", err, ErrUnsolvable)
+	}
+}
+
+func TestPossession01SolverSolve(t *testing.T) {
+	ck := mustGenerateCertificateKey("a.example.com")
+	s, err := NewPossession01Solver(testJWK, 1, ck)
+	if err != nil {
+		t.Fatalf("NewPossession01Solver failed: %v", err)
+	}
+
+	resps, stop, err := s.SolveIdentifiers([]Identifier{DNSIdentifier("a.example.com")}, []protocol.Challenge{possession01Challenge(ck)})
+	if err != nil {
+		t.Fatalf("SolveIdentifiers failed: %v", err)
+	}
+	defer stop()
+
+	resp := resps[0].(*protocol.Possession01Response)
+	bs, err := resp.Authorization.Verify(ck.Key.Public())
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	var got protocol.Possession01Validation
+	if err := json.Unmarshal(bs, &got); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if want := []protocol.Identifier{{Type: protocol.DNS, Value: "a.example.com"}}; !reflect.DeepEqual(got.Identifiers, want) {
+		t.Errorf("SolveIdentifiers Identifiers: got %v, want %v", got.Identifiers, want)
+	}
+	if want := protocol.ChallengePossession01; got.Type != want {
+		t.Errorf("SolveIdentifiers Type: got %v, want %v", got.Type, want)
+	}
+	if !publicKeysEqual(got.AccountKey.Key, testPublicKey) {
+		t.Errorf("SolveIdentifiers AccountKey: got %v, want %v", got.AccountKey.Key, testPublicKey)
+	}
+}
+
+func TestNewPossession01SolverMismatch(t *testing.T) {
+	ck := mustGenerateCertificateKey("a.example.com")
+	ck.Key = mustGenerateCertificateKey("b.example.com").Key
+
+	if _, err := NewPossession01Solver(testJWK, 1, ck); err == nil {
+		t.Errorf("NewPossession01Solver: got success, want error")
+	}
+}
+
+func possession01Challenge(cks ...CertificateKey) *protocol.Possession01Challenge {
+	c := &protocol.Possession01Challenge{
+		Resource: protocol.ResourceChallenge,
+		Type:     protocol.ChallengePossession01,
+		URI:      "http://example.com/chal/1",
+	}
+	for _, ck := range cks {
+		c.Certs = append(c.Certs, protocol.DERData(ck.Certificate))
+	}
+	return c
+}
+
+// mustGenerateCertificateKey creates a self-signed certificate.
+func mustGenerateCertificateKey(name string) CertificateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		panic(err)
+	}
+	return CertificateKey{Certificate: der, Key: key}
+}
@@ -114,6 +114,15 @@ func GetCertificate(g Getter, uri string) ([]byte, *http.Response, error) {
 	return ret, resp, err
 }
 
+// GetRenewalInfo requests the suggested renewal window of a
+// certificate. The uri is the directory's RenewalInfo URI joined
+// with the CertID. RFC 9773 Section 4.1.
+func GetRenewalInfo(g Getter, uri string) (*RenewalInfo, *http.Response, error) {
+	ret := &RenewalInfo{}
+	resp, err := g.Get(uri, JSON, ret)
+	return ret, resp, err
+}
+
 // PostCertificateRevocation sends a revoke-cert request. ACME Section 6.7.
 func PostCertificateRevocation(p Poster, uri string, req *Certificate) (*http.Response, error) {
 	if req.Resource != ResourceRevokeCert {
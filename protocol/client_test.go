@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestGetDirectory(t *testing.T) {
@@ -192,6 +193,30 @@ func TestGetCertificate(t *testing.T) {
 	}
 }
 
+func TestGetRenewalInfo(t *testing.T) {
+	want := &RenewalInfo{
+		SuggestedWindow: SuggestedWindow{
+			Start: Time(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)),
+			End:   Time(time.Date(2025, 1, 3, 3, 4, 5, 0, time.UTC)),
+		},
+		ExplanationURL: "http://example.com/incident",
+	}
+	hc := newStubHTTPClient(want, nil)
+
+	got, _, err := GetRenewalInfo(hc, "http://example.com/renewal-info/a.b")
+	if err != nil {
+		t.Fatalf("GetRenewalInfo failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetRenewalInfo: got %+v, want %+v", got, want)
+	}
+
+	if want := (query{Method: "GET", URL: "http://example.com/renewal-info/a.b", Accept: JSON}); !reflect.DeepEqual(hc.req, want) {
+		t.Errorf("GetRenewalInfo request: got %+v, want %+v", hc.req, want)
+	}
+}
+
 func TestPostCertificateRevocation(t *testing.T) {
 	hc := newStubHTTPClient(nil, nil)
 
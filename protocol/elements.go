@@ -45,6 +45,10 @@ type Directory struct {
 	NewAuthz   string `json:"new-authz"`
 	NewCert    string `json:"new-cert"`
 	RevokeCert string `json:"revoke-cert"`
+
+	// RenewalInfo is the ACME Renewal Information endpoint, if
+	// supported. RFC 9773 Section 4.
+	RenewalInfo string `json:"renewalInfo,omitempty"`
 }
 
 // Recovery is an account recovery request. ACME Section 6.3.
@@ -63,6 +67,23 @@ type Recovery struct {
 type CertificateIssuance struct {
 	Resource ResourceType `json:"resource"`
 	CSR      DERData      `json:"csr"`
+
+	// Replaces is the CertID of the certificate this one renews.
+	// RFC 9773 Section 5.
+	Replaces string `json:"replaces,omitempty"`
+}
+
+// RenewalInfo describes a renewalInfo resource. RFC 9773 Section 4.2.
+type RenewalInfo struct {
+	SuggestedWindow SuggestedWindow `json:"suggestedWindow"`
+	ExplanationURL  string          `json:"explanationURL,omitempty"`
+}
+
+// SuggestedWindow is the time range in which a certificate should be
+// renewed. RFC 9773 Section 4.2.
+type SuggestedWindow struct {
+	Start Time `json:"start"`
+	End   Time `json:"end"`
 }
 
 // Certificate encapsulates an X.509 certificate.
@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"regexp"
+	"sync"
 
 	"gopkg.in/square/go-jose.v2"
 )
@@ -27,11 +28,18 @@ var (
 
 // HTTPClient is an ACME HTTP client. It is an adapter between the
 // standard HTTP client and ACME clients. It marshals requests,
-// identifies errors, unmarshals responses and records nonces.
+// identifies errors, unmarshals responses and records nonces. It is
+// concurrency-safe if the HTTPDoer is.
 type HTTPClient struct {
 	http   HTTPDoer
 	signer jose.Signer
-	nonces *NonceStack
+	nonces nonceAdder
+}
+
+// A nonceAdder is a nonce source that can record nonces returned by
+// the server.
+type nonceAdder interface {
+	add(n string)
 }
 
 // An HTTPDoer is able to make HTTP requests. *net/http.Client is an
@@ -53,7 +61,7 @@ func NewHTTPClient(hc HTTPDoer, signer jose.Signer) *HTTPClient {
 		signer: signer,
 	}
 	if signer != nil {
-		if ns, ok := signer.Options().NonceSource.(*NonceStack); ok {
+		if ns, ok := signer.Options().NonceSource.(nonceAdder); ok {
 			ret.nonces = ns
 		}
 	}
@@ -61,6 +69,17 @@ func NewHTTPClient(hc HTTPDoer, signer jose.Signer) *HTTPClient {
 	return ret
 }
 
+// SetNonceURI makes an empty NoncePool refill itself by sending a
+// HEAD request to uri. It has no effect for other nonce sources.
+func (c *HTTPClient) SetNonceURI(uri string) {
+	if p, ok := c.nonces.(*NoncePool); ok {
+		p.setRefill(func() error {
+			_, err := c.Head(uri)
+			return err
+		})
+	}
+}
+
 // Get performs a GET request to the given URL. It sets the Accept
 // header and parses the response into respBody, unless it is nil. If
 // respBody is nil, the response body must be closed by the caller.
@@ -157,19 +176,27 @@ func (c *HTTPClient) do(req *http.Request, respBody interface{}) (*http.Response
 	return resp, nil
 }
 
-// NonceStack is a stack of nonces implementing jose.NonceSource.
+// NonceStack is a stack of nonces implementing jose.NonceSource. It
+// is concurrency-safe. See also NoncePool.
 type NonceStack struct {
+	mu sync.Mutex
 	ns []string
 }
 
 // add pushes a nonce to the stack.
 func (s *NonceStack) add(n string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.ns = append(s.ns, n)
 }
 
 // Nonce pops a nonce from the stack. Can return ErrNoNonce, in which
 // case a non-secure request should be performed to populate the pool.
 func (s *NonceStack) Nonce() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if len(s.ns) == 0 {
 		return "", ErrNoNonce
 	}
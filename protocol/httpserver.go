@@ -109,8 +109,9 @@ func encodeBody(w io.Writer, contentType string, in interface{}) error {
 }
 
 // readRequest verifies the signature in the JWS body. The nonce is verified
-// against ns. If successful, the function returns the key used to sign the body.
-func readRequest(out interface{}, r *http.Request, ns NonceSource) (crypto.PublicKey, error) {
+// against ns. The algorithm and key are checked against kp, unless nil. If
+// successful, the function returns the key used to sign the body.
+func readRequest(out interface{}, r *http.Request, ns NonceSource, kp *KeyPolicy) (crypto.PublicKey, error) {
 	signed := &JSONWebSignature{}
 	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, int64(requestBodyLimit))).Decode(signed); err != nil {
 		return nil, serverErrorf(http.StatusBadRequest, Malformed, "%v", err)
@@ -124,6 +125,11 @@ func readRequest(out interface{}, r *http.Request, ns NonceSource) (crypto.Publi
 		return nil, serverErrorf(http.StatusForbidden, Unauthorized, "%v", err)
 	}
 	sig := signed.Signatures[0].Header
+	if kp != nil {
+		if err := kp.Check(jose.SignatureAlgorithm(sig.Algorithm), sig.JSONWebKey.Key); err != nil {
+			return nil, err
+		}
+	}
 	if err := ns.Verify(sig.Nonce); err != nil {
 		return nil, serverErrorf(http.StatusForbidden, Unauthorized, "%v", err)
 	}
@@ -238,7 +238,7 @@ func TestReadRequest(t *testing.T) {
 		Body:   ioutil.NopCloser(bytes.NewReader(bs)),
 	}
 	var reg Registration
-	key, err := readRequest(&reg, req, ns)
+	key, err := readRequest(&reg, req, ns, nil)
 	if err != nil {
 		t.Fatalf("readRequest failed: %v", err)
 	}
@@ -250,6 +250,34 @@ func TestReadRequest(t *testing.T) {
 	}
 }
 
+func TestReadRequestKeyPolicy(t *testing.T) {
+	ns := newFakeNonceSource()
+	sig, err := jose.NewSigner(testSigningKey, &jose.SignerOptions{NonceSource: ns, EmbedJWK: true})
+	if err != nil {
+		t.Fatalf("jose.NewSigner failed: %v", err)
+	}
+	signed, err := signJSON(sig, &Registration{Resource: ResourceNewReg})
+	if err != nil {
+		t.Fatalf("signJSON failed: %v", err)
+	}
+	bs, err := json.Marshal(signed)
+	if err != nil {
+		t.Fatalf("json.Marshal(%v) failed: %v", signed, err)
+	}
+
+	req := &http.Request{
+		Method: "POST",
+		Header: http.Header{acceptHeader: []string{PKIXCert}, contentTypeHeader: []string{JSON}},
+		Body:   ioutil.NopCloser(bytes.NewReader(bs)),
+	}
+	var reg Registration
+	// The test key is a 512-bit RSA key.
+	_, err = readRequest(&reg, req, ns, DefaultKeyPolicy)
+	if serr, ok := err.(*ServerError); !ok || serr.Problem.Type != BadPublicKey {
+		t.Fatalf("readRequest err: got %v, want %v", err, BadPublicKey)
+	}
+}
+
 func TestReadRequestBodyLimit(t *testing.T) {
 	bs := []byte(`{"resource":"` + strings.Repeat("12", requestBodyLimit) + `"}`)
 	req := &http.Request{
@@ -258,7 +286,7 @@ func TestReadRequestBodyLimit(t *testing.T) {
 		Body:   ioutil.NopCloser(bytes.NewReader(bs)),
 	}
 	var reg Registration
-	_, err := readRequest(&reg, req, nil)
+	_, err := readRequest(&reg, req, nil, nil)
 	if err == nil {
 		t.Fatalf("readRequest err: got %v, want Bad Request", err)
 	}
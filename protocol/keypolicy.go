@@ -0,0 +1,67 @@
+package protocol
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"net/http"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// A KeyPolicy restricts the JWS algorithms and account keys a server
+// accepts in requests.
+type KeyPolicy struct {
+	// Algorithms is the allowlist of JWS algorithms. If empty, all
+	// asymmetric algorithms supported by go-jose are accepted.
+	Algorithms []jose.SignatureAlgorithm
+
+	// MinRSABits is the minimum RSA modulus size.
+	MinRSABits int
+
+	// MinECDSABits is the minimum ECDSA curve size.
+	MinECDSABits int
+}
+
+// DefaultKeyPolicy accepts the algorithms in common use by ACME
+// clients, with RSA keys of at least 2048 bits.
+var DefaultKeyPolicy = &KeyPolicy{
+	Algorithms:   []jose.SignatureAlgorithm{jose.RS256, jose.PS256, jose.ES256, jose.ES384, jose.ES512, jose.EdDSA},
+	MinRSABits:   2048,
+	MinECDSABits: 256,
+}
+
+// Check returns a ServerError if the algorithm or key is not allowed
+// by the policy. Symmetric keys are never allowed.
+func (p *KeyPolicy) Check(alg jose.SignatureAlgorithm, key crypto.PublicKey) error {
+	if len(p.Algorithms) > 0 {
+		var found bool
+		for _, a := range p.Algorithms {
+			found = found || a == alg
+		}
+		if !found {
+			return serverErrorf(http.StatusBadRequest, BadSignatureAlgorithm, "signature algorithm %q not allowed", alg)
+		}
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if n := k.N.BitLen(); n < p.MinRSABits {
+			return serverErrorf(http.StatusBadRequest, BadPublicKey, "RSA key too small: %d < %d bits", n, p.MinRSABits)
+		}
+
+	case *ecdsa.PublicKey:
+		if n := k.Curve.Params().BitSize; n < p.MinECDSABits {
+			return serverErrorf(http.StatusBadRequest, BadPublicKey, "ECDSA key too small: %d < %d bits", n, p.MinECDSABits)
+		}
+
+	case ed25519.PublicKey:
+		// Fixed size.
+
+	default:
+		return serverErrorf(http.StatusBadRequest, BadPublicKey, "unsupported key type %T", key)
+	}
+
+	return nil
+}
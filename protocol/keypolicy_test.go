@@ -0,0 +1,60 @@
+package protocol
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestKeyPolicyCheck(t *testing.T) {
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	tsts := []struct {
+		Name   string
+		Policy *KeyPolicy
+		Alg    jose.SignatureAlgorithm
+		Key    crypto.PublicKey
+		Exp    ProblemType
+	}{
+		{"es256", DefaultKeyPolicy, jose.ES256, p256.Public(), ""},
+		{"eddsa", DefaultKeyPolicy, jose.EdDSA, edPub, ""},
+		{"smallRSA", DefaultKeyPolicy, jose.RS256, testJWK.Public().Key, BadPublicKey},
+		{"smallECDSA", &KeyPolicy{MinECDSABits: 256}, jose.ES256, p224.Public(), BadPublicKey},
+		{"hmac", &KeyPolicy{}, jose.HS256, []byte("secret"), BadPublicKey},
+		{"rs512", DefaultKeyPolicy, jose.RS512, testJWK.Public().Key, BadSignatureAlgorithm},
+		{"anyAlg", &KeyPolicy{}, jose.RS512, testJWK.Public().Key, ""},
+	}
+	for _, tst := range tsts {
+		err := tst.Policy.Check(tst.Alg, tst.Key)
+		if tst.Exp == "" {
+			if err != nil {
+				t.Errorf("[%s] Check failed: %v", tst.Name, err)
+			}
+			continue
+		}
+		serr, ok := err.(*ServerError)
+		if !ok {
+			t.Errorf("[%s] Check: got %v, want a ServerError", tst.Name, err)
+			continue
+		}
+		if serr.Problem.Type != tst.Exp {
+			t.Errorf("[%s] Check Type: got %v, want %v", tst.Name, serr.Problem.Type, tst.Exp)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package protocol
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultNonceMaxAge is the default age after which a NoncePool
+// discards nonces. Servers expire nonces, and using an expired one
+// costs a failed request.
+const DefaultNonceMaxAge = 5 * time.Minute
+
+// NoncePool is a concurrency-safe pool of nonces implementing
+// jose.NonceSource. Nonces are used most recent first. If the pool is
+// empty, it is refilled by performing a request, if the HTTPClient
+// using it has been told where to get nonces (see
+// HTTPClient.SetNonceURI).
+type NoncePool struct {
+	maxAge time.Duration
+	now    func() time.Time
+
+	mu     sync.Mutex
+	ns     []poolNonce
+	adds   uint64
+	refill func() error
+}
+
+type poolNonce struct {
+	nonce string
+	added time.Time
+}
+
+// NewNoncePool returns a new, empty pool. Nonces older than maxAge
+// are discarded. If maxAge is zero, DefaultNonceMaxAge is used.
+func NewNoncePool(maxAge time.Duration) *NoncePool {
+	if maxAge == 0 {
+		maxAge = DefaultNonceMaxAge
+	}
+	return &NoncePool{maxAge: maxAge, now: time.Now}
+}
+
+// add pushes a nonce to the pool.
+func (p *NoncePool) add(n string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ns = append(p.ns, poolNonce{n, p.now()})
+	p.adds++
+}
+
+// setRefill sets the function used to refill an empty pool.
+func (p *NoncePool) setRefill(f func() error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.refill = f
+}
+
+// Nonce returns an unused nonce. Refills the pool if it is
+// empty. Can return ErrNoNonce if the pool is empty and cannot be
+// refilled.
+func (p *NoncePool) Nonce() (string, error) {
+	for {
+		p.mu.Lock()
+		refill := p.refill
+		adds := p.adds
+		p.mu.Unlock()
+
+		if n, ok := p.pop(); ok {
+			return n, nil
+		}
+		if refill == nil {
+			return "", ErrNoNonce
+		}
+		if err := refill(); err != nil {
+			return "", err
+		}
+
+		if n, ok := p.pop(); ok {
+			return n, nil
+		}
+
+		// Another caller may have taken the nonce we fetched. Try
+		// again, unless the refill didn't yield any nonce at all.
+		p.mu.Lock()
+		added := p.adds != adds
+		p.mu.Unlock()
+		if !added {
+			return "", ErrNoNonce
+		}
+	}
+}
+
+// Len returns the number of fresh nonces in the pool.
+func (p *NoncePool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.evictLocked()
+	return len(p.ns)
+}
+
+// pop removes and returns the most recent fresh nonce.
+func (p *NoncePool) pop() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.evictLocked()
+	if len(p.ns) == 0 {
+		return "", false
+	}
+
+	n := len(p.ns)
+	ret := p.ns[n-1]
+	p.ns = p.ns[:n-1]
+	return ret.nonce, true
+}
+
+// evictLocked removes stale nonces. Nonces are ordered by age, so
+// stale ones are at the front.
+func (p *NoncePool) evictLocked() {
+	cutoff := p.now().Add(-p.maxAge)
+	i := 0
+	for i < len(p.ns) && p.ns[i].added.Before(cutoff) {
+		i++
+	}
+	if i > 0 {
+		p.ns = append(p.ns[:0], p.ns[i:]...)
+	}
+}
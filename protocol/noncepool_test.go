@@ -0,0 +1,139 @@
+package protocol
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestNoncePoolNonce(t *testing.T) {
+	now := time.Unix(1000, 0)
+	p := NewNoncePool(time.Minute)
+	p.now = func() time.Time { return now }
+
+	p.add("a")
+	now = now.Add(time.Minute / 2)
+	p.add("b")
+	p.add("c")
+
+	if got, want := p.Len(), 3; got != want {
+		t.Errorf("Len: got %v, want %v", got, want)
+	}
+	if got, err := p.Nonce(); err != nil || got != "c" {
+		t.Errorf("Nonce: got %q, %v, want %q", got, err, "c")
+	}
+
+	// "a" is now stale.
+	now = now.Add(time.Minute * 3 / 4)
+	if got, want := p.Len(), 1; got != want {
+		t.Errorf("Len (stale): got %v, want %v", got, want)
+	}
+	if got, err := p.Nonce(); err != nil || got != "b" {
+		t.Errorf("Nonce: got %q, %v, want %q", got, err, "b")
+	}
+	if _, err := p.Nonce(); err != ErrNoNonce {
+		t.Errorf("Nonce (empty): got %v, want %v", err, ErrNoNonce)
+	}
+}
+
+func TestNoncePoolRefill(t *testing.T) {
+	p := NewNoncePool(0)
+	var refills int
+	p.setRefill(func() error {
+		refills++
+		p.add("fresh")
+		return nil
+	})
+
+	if got, err := p.Nonce(); err != nil || got != "fresh" {
+		t.Errorf("Nonce: got %q, %v, want %q", got, err, "fresh")
+	}
+	if refills != 1 {
+		t.Errorf("Nonce refills: got %v, want 1", refills)
+	}
+
+	p.setRefill(func() error { return errors.New("mock error") })
+	if _, err := p.Nonce(); err == nil {
+		t.Errorf("Nonce: got success, want error")
+	}
+
+	p.setRefill(func() error { return nil })
+	if _, err := p.Nonce(); err != ErrNoNonce {
+		t.Errorf("Nonce (no nonce): got %v, want %v", err, ErrNoNonce)
+	}
+}
+
+func TestNoncePoolRefillTaken(t *testing.T) {
+	p := NewNoncePool(0)
+	var refills int
+	p.setRefill(func() error {
+		refills++
+		p.add(string(rune('a' + refills)))
+		if refills == 1 {
+			// Another caller takes the nonce before we get to it.
+			p.pop()
+		}
+		return nil
+	})
+
+	if got, err := p.Nonce(); err != nil || got != "c" {
+		t.Errorf("Nonce: got %q, %v, want %q", got, err, "c")
+	}
+	if refills != 2 {
+		t.Errorf("Nonce refills: got %v, want 2", refills)
+	}
+}
+
+func TestNoncePoolConcurrent(t *testing.T) {
+	p := NewNoncePool(0)
+	var mu sync.Mutex
+	var i int
+	p.setRefill(func() error {
+		mu.Lock()
+		i++
+		n := string(rune('a' + i%26))
+		mu.Unlock()
+		p.add(n)
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for j := 0; j < 16; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < 100; k++ {
+				if _, err := p.Nonce(); err != nil {
+					t.Errorf("Nonce failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestHTTPClientSetNonceURI(t *testing.T) {
+	hts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "HEAD" {
+			t.Errorf("SetNonceURI method: got %q, want HEAD", r.Method)
+		}
+		w.Header().Set(ReplayNonce, "abc")
+	}))
+	defer hts.Close()
+
+	s, err := jose.NewSigner(testSigningKey, &jose.SignerOptions{NonceSource: NewNoncePool(0)})
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+	c := NewHTTPClient(nil, s)
+	c.SetNonceURI(hts.URL)
+
+	if got, err := s.Options().NonceSource.Nonce(); err != nil || got != "abc" {
+		t.Errorf("Nonce: got %q, %v, want %q", got, err, "abc")
+	}
+}
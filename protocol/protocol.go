@@ -40,6 +40,9 @@ type IdentifierType string
 
 const (
 	DNS IdentifierType = "dns"
+
+	// IP is an IP address identifier. RFC 8738.
+	IP IdentifierType = "ip"
 )
 
 type Status string
@@ -64,16 +67,18 @@ const (
 	// Section 5.4.
 	// TODO: Marked as TODO in draft.
 	// Which namespace is it using? urn:acme or urn:acme:error?
-	errorNamespace  ProblemType = "urn:acme:error:"
-	BadCSR          ProblemType = errorNamespace + "badCSR"
-	BadNonce        ProblemType = errorNamespace + "badNonce"
-	ConnectionError ProblemType = errorNamespace + "connection"
-	DNSSECError     ProblemType = errorNamespace + "dnssec"
-	Malformed       ProblemType = errorNamespace + "malformed"
-	ServerInternal  ProblemType = errorNamespace + "serverInternal"
-	TLSError        ProblemType = errorNamespace + "tls"
-	Unauthorized    ProblemType = errorNamespace + "unauthorized"
-	UnknownHost     ProblemType = errorNamespace + "unknownHost"
+	errorNamespace        ProblemType = "urn:acme:error:"
+	BadCSR                ProblemType = errorNamespace + "badCSR"
+	BadNonce              ProblemType = errorNamespace + "badNonce"
+	BadPublicKey          ProblemType = errorNamespace + "badPublicKey"
+	BadSignatureAlgorithm ProblemType = errorNamespace + "badSignatureAlgorithm"
+	ConnectionError       ProblemType = errorNamespace + "connection"
+	DNSSECError           ProblemType = errorNamespace + "dnssec"
+	Malformed             ProblemType = errorNamespace + "malformed"
+	ServerInternal        ProblemType = errorNamespace + "serverInternal"
+	TLSError              ProblemType = errorNamespace + "tls"
+	Unauthorized          ProblemType = errorNamespace + "unauthorized"
+	UnknownHost           ProblemType = errorNamespace + "unknownHost"
 )
 
 type RecoveryMethod string
@@ -34,13 +34,30 @@ type HTTPServer interface {
 type HTTPDispatcher struct {
 	s  HTTPServer
 	ns NonceSource
+	kp *KeyPolicy
+}
+
+// An HTTPDispatcherOpt is an option for NewHTTPDispatcher.
+type HTTPDispatcherOpt func(*HTTPDispatcher)
+
+// WithKeyPolicy restricts the signature algorithms and account keys
+// accepted in requests. By default, any key go-jose can verify is
+// accepted. See DefaultKeyPolicy.
+func WithKeyPolicy(kp *KeyPolicy) HTTPDispatcherOpt {
+	return func(d *HTTPDispatcher) {
+		d.kp = kp
+	}
 }
 
 // NewHTTPDispatcher creates a new dispatcher for the given server
 // with the given nonce source used to create response nonces and
 // validate request nonces. Both s and ns must be concurrency-safe.
-func NewHTTPDispatcher(s HTTPServer, ns NonceSource) *HTTPDispatcher {
-	return &HTTPDispatcher{s, ns}
+func NewHTTPDispatcher(s HTTPServer, ns NonceSource, opts ...HTTPDispatcherOpt) *HTTPDispatcher {
+	d := &HTTPDispatcher{s: s, ns: ns}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
 }
 
 // ServeDirectory serves up the ACME directory.
@@ -175,7 +192,7 @@ func (d *HTTPDispatcher) serve(w http.ResponseWriter, r *http.Request, accept st
 			writeError(w, serverErrorf(http.StatusNotAcceptable, Malformed, "only %s supported, got %s", accept, got))
 			return
 		}
-		key, err := readRequest(body, r, d.ns)
+		key, err := readRequest(body, r, d.ns, d.kp)
 		if err != nil {
 			writeError(w, err)
 			return
@@ -196,8 +213,8 @@ func (d *HTTPDispatcher) serve(w http.ResponseWriter, r *http.Request, accept st
 // given http.ServeMux-like object at the same paths as Let's
 // Encrypt's Boulder server. These paths are not mandated by the ACME
 // specification, but are good defaults.
-func RegisterBoulderHTTP(mux HTTPHandlerHandler, s HTTPServer, ns NonceSource) {
-	d := NewHTTPDispatcher(s, ns)
+func RegisterBoulderHTTP(mux HTTPHandlerHandler, s HTTPServer, ns NonceSource, opts ...HTTPDispatcherOpt) {
+	d := NewHTTPDispatcher(s, ns, opts...)
 
 	mux.Handle(DirectoryPath, http.HandlerFunc(d.ServeDirectory))
 	mux.Handle(NewAuthzPath, http.HandlerFunc(d.ServeNewAuthz))
@@ -0,0 +1,588 @@
+// Package renew keeps certificates in a storage.Storage up to date
+// by renewing them before they expire.
+package renew
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tommie/acme-go"
+	"github.com/tommie/acme-go/storage"
+)
+
+var (
+	ErrNotManaged = errors.New("certificate is not managed")
+	ErrNoNames    = errors.New("no DNS names")
+)
+
+const (
+	// DefaultRenewalFraction is the part of a certificate's
+	// lifetime that passes before it is renewed.
+	DefaultRenewalFraction = 2.0 / 3
+
+	DefaultMinBackoff = time.Minute
+	DefaultMaxBackoff = 24 * time.Hour
+)
+
+// A DeployHook is run after a certificate has been renewed and
+// stored, e.g. to reload a server using it.
+type DeployHook func(name string, b *storage.Bundle) error
+
+// A Window is a time range in which a certificate should be renewed.
+type Window struct {
+	Start, End time.Time
+
+	// NextCheck is when the window should be fetched again, or
+	// zero if it doesn't change.
+	NextCheck time.Time
+}
+
+// A WindowFunc returns a renewal window suggested by the server for
+// a certificate. If it returns nil or an error, the renewal fraction
+// is used instead.
+type WindowFunc func(name string, cert *x509.Certificate) (*Window, error)
+
+// CertificateStatus describes the schedule of a managed certificate.
+type CertificateStatus struct {
+	Name     string
+	DNSNames []string
+
+	// NotAfter is the expiry of the stored certificate, or zero if
+	// none has been issued yet.
+	NotAfter time.Time
+
+	// NextRenewal is when the next attempt, or check of the
+	// suggested renewal window, is scheduled.
+	NextRenewal time.Time
+
+	// RenewalTime is the chosen time to renew the stored
+	// certificate. NextCheck is when the suggested renewal window
+	// is fetched again, or zero.
+	RenewalTime time.Time
+	NextCheck   time.Time
+
+	// LastRenewal is the time of the last successful renewal by
+	// this manager.
+	LastRenewal time.Time
+
+	// LastError is the error of the last attempt, or nil if it
+	// succeeded. Failures is the number of consecutive failed
+	// attempts.
+	LastError error
+	Failures  int
+
+	// DeployError is the error of the deploy hooks after the last
+	// successful renewal.
+	DeployError error
+}
+
+// certState is the status of a certificate, and the certificate its
+// schedule was computed for.
+type certState struct {
+	CertificateStatus
+
+	leaf []byte
+}
+
+// config is the managed certificate configuration, stored as
+// storage.KindConfig.
+type config struct {
+	DNSNames []string `json:"dnsNames"`
+}
+
+// A Manager renews managed certificates of an account in a storage,
+// at a fraction of their lifetime, or in a server-suggested window.
+// Failed renewals are retried with exponential backoff. Several
+// managers, e.g. in different replicas, can share a storage: issuance
+// is serialized by the storage's Locker, and a manager picks up
+// certificates renewed by others. Its functions are
+// concurrency-safe.
+type Manager struct {
+	s       storage.Storage
+	account string
+	ci      *acme.CertificateIssuer
+	solver  acme.Solver
+	cf      storage.CertificateFetcher
+
+	fraction   float64
+	window     WindowFunc
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	hooks      []DeployHook
+	newKey     func() (crypto.Signer, error)
+	now        func() time.Time
+
+	mu    sync.Mutex
+	certs map[string]*certState
+
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// A ManagerOpt is an option for NewManager.
+type ManagerOpt func(*Manager)
+
+// WithRenewalFraction sets the part of the lifetime after which a
+// certificate is renewed. The default is DefaultRenewalFraction.
+func WithRenewalFraction(f float64) ManagerOpt {
+	return func(m *Manager) {
+		m.fraction = f
+	}
+}
+
+// WithRenewalWindow makes the manager ask wf for a server-suggested
+// renewal window. The renewal is scheduled at a random time within
+// the window, and the window is checked again at its NextCheck. The
+// chosen time is kept as long as it is inside the window. See
+// RenewalInfoWindow.
+func WithRenewalWindow(wf WindowFunc) ManagerOpt {
+	return func(m *Manager) {
+		m.window = wf
+	}
+}
+
+// WithBackoff sets the delay before retrying after the first failed
+// renewal. It doubles for every failure, up to max.
+func WithBackoff(min, max time.Duration) ManagerOpt {
+	return func(m *Manager) {
+		m.minBackoff = min
+		m.maxBackoff = max
+	}
+}
+
+// WithDeployHook adds a hook run after each successful renewal. Hooks
+// are run in the order they were added.
+func WithDeployHook(h DeployHook) ManagerOpt {
+	return func(m *Manager) {
+		m.hooks = append(m.hooks, h)
+	}
+}
+
+// WithKeyGenerator sets the function creating a new private key for
+// each renewal. The default generates ECDSA P-256 keys.
+func WithKeyGenerator(newKey func() (crypto.Signer, error)) ManagerOpt {
+	return func(m *Manager) {
+		m.newKey = newKey
+	}
+}
+
+// NewManager creates a manager for certificates of an account in s.
+// Certificates are issued with ci and solver, and the chain is
+// fetched with cf, unless nil. Use Manage or Load to add
+// certificates, and Run to start renewing.
+func NewManager(s storage.Storage, account string, ci *acme.CertificateIssuer, solver acme.Solver, cf storage.CertificateFetcher, opts ...ManagerOpt) *Manager {
+	m := &Manager{
+		s:          s,
+		account:    account,
+		ci:         ci,
+		solver:     solver,
+		cf:         cf,
+		fraction:   DefaultRenewalFraction,
+		minBackoff: DefaultMinBackoff,
+		maxBackoff: DefaultMaxBackoff,
+		newKey:     generateKey,
+		now:        time.Now,
+		certs:      map[string]*certState{},
+		wake:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Manage starts managing a certificate for the given DNS names. The
+// configuration is kept in storage, so Load finds it later. If no
+// certificate is stored yet, one is issued as soon as Run gets to
+// it.
+func (m *Manager) Manage(name string, dnsNames []string) error {
+	if len(dnsNames) == 0 {
+		return ErrNoNames
+	}
+	bs, err := json.Marshal(&config{DNSNames: dnsNames})
+	if err != nil {
+		return err
+	}
+	if err := m.s.Put(m.account, name, storage.KindConfig, bs); err != nil {
+		return err
+	}
+
+	m.track(name, dnsNames)
+	return nil
+}
+
+// Unmanage stops managing a certificate and removes all its items
+// from storage.
+func (m *Manager) Unmanage(name string) error {
+	m.mu.Lock()
+	_, ok := m.certs[name]
+	delete(m.certs, name)
+	m.mu.Unlock()
+	if !ok {
+		return ErrNotManaged
+	}
+	m.signal()
+
+	return m.s.Delete(m.account, name)
+}
+
+// Load starts managing all certificates of the account that have a
+// configuration in storage. A certificate that cannot be read is
+// still managed, with the error in its status.
+func (m *Manager) Load() error {
+	names, err := m.s.List(m.account)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		bs, err := m.s.Get(m.account, name, storage.KindConfig)
+		if err == storage.ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		var cfg config
+		if err := json.Unmarshal(bs, &cfg); err != nil {
+			return fmt.Errorf("loading %s: %v", name, err)
+		}
+		m.track(name, cfg.DNSNames)
+	}
+
+	return nil
+}
+
+// track adds a certificate to the schedule, based on the currently
+// stored certificate, if any. If that cannot be read, the error is
+// recorded and reading is retried after a backoff.
+func (m *Manager) track(name string, dnsNames []string) {
+	st := &certState{CertificateStatus: CertificateStatus{
+		Name:        name,
+		DNSNames:    dnsNames,
+		NextRenewal: m.now(),
+	}}
+	leaf, err := m.storedLeaf(name)
+	if err != nil && err != storage.ErrNotFound {
+		m.fail(st, err)
+	} else if err == nil {
+		st.setSchedule(leaf, m.newSchedule(name, leaf, time.Time{}))
+	}
+
+	m.mu.Lock()
+	m.certs[name] = st
+	m.mu.Unlock()
+	m.signal()
+}
+
+// Status returns the schedule of all managed certificates, sorted by
+// name.
+func (m *Manager) Status() []CertificateStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ret := make([]CertificateStatus, 0, len(m.certs))
+	for _, st := range m.certs {
+		ret = append(ret, st.CertificateStatus)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// Run renews certificates when they are due, until Stop is called.
+// Renewals are done one at a time.
+func (m *Manager) Run() {
+	for {
+		name, at := m.next()
+
+		var timer *time.Timer
+		var timerC <-chan time.Time
+		if name != "" {
+			timer = time.NewTimer(at.Sub(m.now()))
+			timerC = timer.C
+		}
+
+		select {
+		case <-m.stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+
+		case <-m.wake:
+			if timer != nil {
+				timer.Stop()
+			}
+
+		case <-timerC:
+			m.renew(name, false)
+		}
+	}
+}
+
+// Stop makes Run return after any ongoing renewal.
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
+
+// Renew renews a certificate now, regardless of its schedule.
+func (m *Manager) Renew(name string) error {
+	return m.renew(name, true)
+}
+
+// next returns the certificate with the earliest scheduled renewal,
+// or an empty name if there are none.
+func (m *Manager) next() (string, time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var name string
+	var at time.Time
+	for _, st := range m.certs {
+		if name == "" || st.NextRenewal.Before(at) {
+			name = st.Name
+			at = st.NextRenewal
+		}
+	}
+	return name, at
+}
+
+func (m *Manager) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// renew issues a new certificate and updates the schedule. Unless
+// forced, the stored certificate is first checked to still be due:
+// another manager may have renewed it, and if the renewal window is
+// due to be checked, it is fetched again.
+func (m *Manager) renew(name string, force bool) error {
+	m.mu.Lock()
+	st, ok := m.certs[name]
+	var dnsNames []string
+	var scheduled []byte
+	var renewAt, nextCheck time.Time
+	if ok {
+		dnsNames = st.DNSNames
+		scheduled = st.leaf
+		renewAt = st.RenewalTime
+		nextCheck = st.NextCheck
+	}
+	m.mu.Unlock()
+	if !ok {
+		return ErrNotManaged
+	}
+
+	old, err := m.storedLeaf(name)
+	if err != nil && err != storage.ErrNotFound {
+		m.update(name, func(st *certState) {
+			m.fail(st, err)
+		})
+		return err
+	}
+	if !force && old != nil {
+		now := m.now()
+		switch {
+		case !bytes.Equal(old.Raw, scheduled):
+			// Renewed by another manager.
+			renewAt = time.Time{}
+			fallthrough
+
+		case !nextCheck.IsZero() && !nextCheck.After(now):
+			sch := m.newSchedule(name, old, renewAt)
+			changed := !bytes.Equal(old.Raw, scheduled)
+			m.update(name, func(st *certState) {
+				st.setSchedule(old, sch)
+				if changed {
+					// Earlier failures were about another
+					// certificate, or reading it.
+					st.LastError = nil
+					st.Failures = 0
+				}
+			})
+			if sch.renewAt.After(now) {
+				return nil
+			}
+
+		case renewAt.After(now):
+			return nil
+		}
+	}
+
+	b, leaf, err := m.issue(name, dnsNames, old)
+	if err != nil {
+		m.update(name, func(st *certState) {
+			m.fail(st, err)
+		})
+		return err
+	}
+
+	derr := m.deploy(name, b)
+	sch := m.newSchedule(name, leaf, time.Time{})
+	m.update(name, func(st *certState) {
+		st.setSchedule(leaf, sch)
+		st.LastRenewal = m.now()
+		st.LastError = nil
+		st.Failures = 0
+		st.DeployError = derr
+	})
+
+	return derr
+}
+
+// update modifies the status of a certificate, if it is still
+// managed, and reschedules.
+func (m *Manager) update(name string, fn func(*certState)) {
+	m.mu.Lock()
+	if st, ok := m.certs[name]; ok {
+		fn(st)
+	}
+	m.mu.Unlock()
+	m.signal()
+}
+
+// issue creates a new key and issues a certificate for it. If old is
+// not nil, the server is told the new certificate replaces it. If the
+// stored certificate is no longer old, it was renewed by another
+// manager, and is returned instead.
+func (m *Manager) issue(name string, dnsNames []string, old *x509.Certificate) (*storage.Bundle, *x509.Certificate, error) {
+	key, err := m.newKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := acme.NewCSR(acme.IdentifiersFromNames(dnsNames...), key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ci := m.ci
+	var prev []byte
+	if old != nil {
+		if id, err := acme.CertID(old); err == nil {
+			ci = ci.Replacing(id)
+		}
+		prev = old.Raw
+	}
+
+	b, err := storage.Issue(m.s, m.account, name, ci, m.solver, m.cf, key, csr, storage.WithPrevious(prev))
+	if err != nil {
+		return nil, nil, err
+	}
+	leaf, err := x509.ParseCertificate(b.Certificate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return b, leaf, nil
+}
+
+// deploy runs all deploy hooks, and returns the first error.
+func (m *Manager) deploy(name string, b *storage.Bundle) error {
+	var ret error
+	for _, h := range m.hooks {
+		if err := h(name, b); err != nil && ret == nil {
+			ret = fmt.Errorf("deploy hook: %v", err)
+		}
+	}
+	return ret
+}
+
+// storedLeaf returns the parsed certificate currently in storage. A
+// bundle with a mismatched key, or that cannot be parsed, is reported
+// as storage.ErrNotFound, so it is replaced.
+func (m *Manager) storedLeaf(name string) (*x509.Certificate, error) {
+	b, err := storage.GetBundle(m.s, m.account, name)
+	if err == storage.ErrKeyMismatch || errors.Is(err, storage.ErrBadBundle) {
+		return nil, storage.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(b.Certificate)
+}
+
+// A schedule is when a certificate should be renewed, and when its
+// renewal window should be checked again, or zero.
+type schedule struct {
+	renewAt   time.Time
+	nextCheck time.Time
+}
+
+// newSchedule returns the schedule of a certificate. A random time in
+// the suggested window is chosen, unless the previously chosen time
+// prev is still in it.
+func (m *Manager) newSchedule(name string, leaf *x509.Certificate, prev time.Time) schedule {
+	if m.window != nil {
+		w, err := m.window(name, leaf)
+		if err == nil && w != nil && !w.End.Before(w.Start) {
+			t := prev
+			if t.Before(w.Start) || t.After(w.End) {
+				t = randomTime(w.Start, w.End)
+			}
+			return schedule{renewAt: t, nextCheck: w.NextCheck}
+		}
+	}
+
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return schedule{renewAt: leaf.NotBefore.Add(time.Duration(float64(lifetime) * m.fraction))}
+}
+
+// setSchedule updates the status for a stored certificate and its
+// schedule. The next renewal is at the earlier of the renewal time
+// and the next window check.
+func (st *certState) setSchedule(leaf *x509.Certificate, sch schedule) {
+	st.leaf = leaf.Raw
+	st.NotAfter = leaf.NotAfter
+	st.RenewalTime = sch.renewAt
+	st.NextCheck = sch.nextCheck
+	st.NextRenewal = sch.renewAt
+	if !sch.nextCheck.IsZero() && sch.nextCheck.Before(sch.renewAt) {
+		st.NextRenewal = sch.nextCheck
+	}
+}
+
+// fail records a failed renewal and schedules a retry with backoff.
+func (m *Manager) fail(st *certState, err error) {
+	st.LastError = err
+	st.Failures++
+	st.NextRenewal = m.now().Add(m.backoff(st.Failures))
+}
+
+// backoff returns the retry delay after n consecutive failures.
+func (m *Manager) backoff(n int) time.Duration {
+	d := m.minBackoff
+	for i := 1; i < n && d < m.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > m.maxBackoff {
+		d = m.maxBackoff
+	}
+	return d
+}
+
+// randomTime returns a uniformly random time in [start, end].
+func randomTime(start, end time.Time) time.Time {
+	d := end.Sub(start)
+	if d <= 0 {
+		return start
+	}
+	return start.Add(time.Duration(mrand.Int63n(int64(d) + 1)))
+}
+
+func generateKey() (crypto.Signer, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
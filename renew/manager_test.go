@@ -0,0 +1,364 @@
+package renew
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tommie/acme-go"
+	"github.com/tommie/acme-go/protocol"
+	"github.com/tommie/acme-go/storage"
+)
+
+func TestManagerRun(t *testing.T) {
+	s := mustNewStorage(t)
+	ia := newStubIssuingAccount(90 * 24 * time.Hour)
+	deployed := make(chan string, 1)
+	m := NewManager(s, "acct", acme.NewCertificateIssuer(ia), acme.TypeSolver{}, nil, WithDeployHook(func(name string, b *storage.Bundle) error {
+		deployed <- name
+		return nil
+	}))
+
+	if err := m.Manage("example", []string{"example.com", "www.example.com"}); err != nil {
+		t.Fatalf("Manage failed: %v", err)
+	}
+	go m.Run()
+	defer m.Stop()
+
+	select {
+	case name := <-deployed:
+		if name != "example" {
+			t.Errorf("deploy hook name: got %q, want %q", name, "example")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Run: timed out waiting for renewal")
+	}
+	m.Stop()
+
+	b, err := storage.GetBundle(s, "acct", "example")
+	if err != nil {
+		t.Fatalf("GetBundle failed: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(b.Certificate)
+	if err != nil {
+		t.Fatalf("ParseCertificate failed: %v", err)
+	}
+
+	sts := m.Status()
+	if len(sts) != 1 {
+		t.Fatalf("Status: got %d certificates, want 1", len(sts))
+	}
+	st := sts[0]
+	if st.LastError != nil || st.Failures != 0 {
+		t.Errorf("Status: got error %v (%d failures), want none", st.LastError, st.Failures)
+	}
+	if !st.NotAfter.Equal(leaf.NotAfter) {
+		t.Errorf("Status NotAfter: got %v, want %v", st.NotAfter, leaf.NotAfter)
+	}
+	if want := leaf.NotBefore.Add(60 * 24 * time.Hour); !st.NextRenewal.Equal(want) {
+		t.Errorf("Status NextRenewal: got %v, want %v", st.NextRenewal, want)
+	}
+}
+
+func TestManagerLoad(t *testing.T) {
+	s := mustNewStorage(t)
+	ia := newStubIssuingAccount(90 * 24 * time.Hour)
+	m := NewManager(s, "acct", acme.NewCertificateIssuer(ia), acme.TypeSolver{}, nil)
+	if err := m.Manage("example", []string{"example.com"}); err != nil {
+		t.Fatalf("Manage failed: %v", err)
+	}
+	if err := s.Put("acct", "unmanaged", storage.KindCertificate, nil); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	m2 := NewManager(s, "acct", acme.NewCertificateIssuer(ia), acme.TypeSolver{}, nil)
+	if err := m2.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := m2.Status(); len(got) != 1 || got[0].Name != "example" || !got[0].NotAfter.IsZero() {
+		t.Fatalf("Load: got %+v, want one unissued certificate", got)
+	}
+
+	if err := m.Renew("example"); err != nil {
+		t.Fatalf("Renew failed: %v", err)
+	}
+
+	// The first manager renewed the certificate, so the second
+	// adopts it without issuing.
+	if err := m2.renew("example", false); err != nil {
+		t.Fatalf("renew failed: %v", err)
+	}
+	if ia.issued != 1 {
+		t.Errorf("renew issued: got %d, want 1", ia.issued)
+	}
+	got, want := m2.Status()[0], m.Status()[0]
+	if !got.NotAfter.Equal(want.NotAfter) || !got.NextRenewal.Equal(want.NextRenewal) {
+		t.Errorf("renew: got %+v, want %+v", got, want)
+	}
+}
+
+func TestManagerBackoff(t *testing.T) {
+	s := mustNewStorage(t)
+	ia := newStubIssuingAccount(90 * 24 * time.Hour)
+	ia.err = errors.New("mock error")
+	now := time.Unix(1000, 0)
+	m := NewManager(s, "acct", acme.NewCertificateIssuer(ia), acme.TypeSolver{}, nil, WithBackoff(time.Minute, 3*time.Minute))
+	m.now = func() time.Time { return now }
+	if err := m.Manage("example", []string{"example.com"}); err != nil {
+		t.Fatalf("Manage failed: %v", err)
+	}
+
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		if err := m.Renew("example"); err == nil {
+			t.Fatalf("Renew: got success, want error")
+		}
+		st := m.Status()[0]
+		if st.LastError == nil {
+			t.Errorf("Status LastError: got nil, want error")
+		}
+		if got := st.NextRenewal.Sub(now); got != want {
+			t.Errorf("[%d] Status NextRenewal: got %v, want %v", st.Failures, got, want)
+		}
+	}
+
+	ia.err = nil
+	if err := m.Renew("example"); err != nil {
+		t.Fatalf("Renew failed: %v", err)
+	}
+	if st := m.Status()[0]; st.LastError != nil || st.Failures != 0 {
+		t.Errorf("Status: got error %v (%d failures), want none", st.LastError, st.Failures)
+	}
+}
+
+func TestManagerStorageError(t *testing.T) {
+	s := &flakyStorage{Storage: mustNewStorage(t)}
+	ia := newStubIssuingAccount(90 * 24 * time.Hour)
+	now := time.Unix(1000, 0)
+	m := NewManager(s, "acct", acme.NewCertificateIssuer(ia), acme.TypeSolver{}, nil, WithBackoff(time.Minute, 3*time.Minute))
+	m.now = func() time.Time { return now }
+	for _, name := range []string{"a", "b"} {
+		if err := m.Manage(name, []string{name + ".example.com"}); err != nil {
+			t.Fatalf("Manage failed: %v", err)
+		}
+		if err := m.Renew(name); err != nil {
+			t.Fatalf("Renew failed: %v", err)
+		}
+	}
+
+	// One unreadable bundle doesn't stop the others from loading.
+	s.err = errors.New("mock error")
+	s.name = "a"
+	m2 := NewManager(s, "acct", acme.NewCertificateIssuer(ia), acme.TypeSolver{}, nil, WithBackoff(time.Minute, 3*time.Minute))
+	m2.now = func() time.Time { return now }
+	if err := m2.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	sts := m2.Status()
+	if len(sts) != 2 {
+		t.Fatalf("Load: got %+v, want two certificates", sts)
+	}
+	if st := sts[0]; st.LastError == nil || st.Failures != 1 || st.NextRenewal.Sub(now) != time.Minute {
+		t.Errorf("Load a: got %+v, want an error and a retry in 1m", st)
+	}
+	if st := sts[1]; st.LastError != nil || st.NotAfter.IsZero() {
+		t.Errorf("Load b: got %+v, want a loaded certificate", st)
+	}
+
+	// Failed reads back off, like failed issuance.
+	if err := m2.renew("a", false); err == nil {
+		t.Fatalf("renew: got success, want error")
+	}
+	if st := m2.Status()[0]; st.Failures != 2 || st.NextRenewal.Sub(now) != 2*time.Minute {
+		t.Errorf("renew: got %+v, want 2 failures and a retry in 2m", st)
+	}
+
+	s.err = nil
+	if err := m2.renew("a", false); err != nil {
+		t.Fatalf("renew failed: %v", err)
+	}
+	if st := m2.Status()[0]; st.LastError != nil || st.Failures != 0 || st.NotAfter.IsZero() {
+		t.Errorf("renew: got %+v, want the stored certificate adopted", st)
+	}
+	if ia.issued != 2 {
+		t.Errorf("renew issued: got %d, want 2", ia.issued)
+	}
+}
+
+func TestManagerRenewalWindow(t *testing.T) {
+	s := mustNewStorage(t)
+	ia := newStubIssuingAccount(90 * 24 * time.Hour)
+	start := time.Now().Add(time.Hour).Truncate(time.Second)
+	m := NewManager(s, "acct", acme.NewCertificateIssuer(ia), acme.TypeSolver{}, nil, WithRenewalWindow(func(name string, cert *x509.Certificate) (*Window, error) {
+		return &Window{Start: start, End: start}, nil
+	}))
+	if err := m.Manage("example", []string{"example.com"}); err != nil {
+		t.Fatalf("Manage failed: %v", err)
+	}
+	if err := m.Renew("example"); err != nil {
+		t.Fatalf("Renew failed: %v", err)
+	}
+
+	if got := m.Status()[0].NextRenewal; !got.Equal(start) {
+		t.Errorf("Status NextRenewal: got %v, want %v", got, start)
+	}
+}
+
+func TestManagerDeployError(t *testing.T) {
+	s := mustNewStorage(t)
+	ia := newStubIssuingAccount(90 * 24 * time.Hour)
+	m := NewManager(s, "acct", acme.NewCertificateIssuer(ia), acme.TypeSolver{}, nil, WithDeployHook(func(name string, b *storage.Bundle) error {
+		return errors.New("mock error")
+	}))
+	if err := m.Manage("example", []string{"example.com"}); err != nil {
+		t.Fatalf("Manage failed: %v", err)
+	}
+
+	if err := m.Renew("example"); err == nil {
+		t.Errorf("Renew: got success, want error")
+	}
+	st := m.Status()[0]
+	if st.DeployError == nil {
+		t.Errorf("Status DeployError: got nil, want error")
+	}
+	if st.LastError != nil || st.NotAfter.IsZero() {
+		t.Errorf("Status: got %+v, want renewed", st)
+	}
+}
+
+func TestManagerUnmanage(t *testing.T) {
+	s := mustNewStorage(t)
+	m := NewManager(s, "acct", nil, nil, nil)
+	if err := m.Manage("example", []string{"example.com"}); err != nil {
+		t.Fatalf("Manage failed: %v", err)
+	}
+	if err := m.Unmanage("example"); err != nil {
+		t.Fatalf("Unmanage failed: %v", err)
+	}
+	if got := m.Status(); len(got) != 0 {
+		t.Errorf("Status: got %v, want empty", got)
+	}
+	if err := m.Unmanage("example"); err != ErrNotManaged {
+		t.Errorf("Unmanage: got %v, want %v", err, ErrNotManaged)
+	}
+	if err := m.Manage("example", nil); err != ErrNoNames {
+		t.Errorf("Manage: got %v, want %v", err, ErrNoNames)
+	}
+}
+
+func mustNewStorage(t *testing.T) storage.Storage {
+	s, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+	return s
+}
+
+// stubIssuingAccount is an acme.IssuingAccount where all
+// authorizations are already valid. It signs certificates with a
+// test CA.
+// flakyStorage fails reading the certificate items of name with err,
+// if set.
+type flakyStorage struct {
+	storage.Storage
+
+	err  error
+	name string
+}
+
+func (s *flakyStorage) Get(account, name string, kind storage.Kind) ([]byte, error) {
+	if s.err != nil && name == s.name && kind != storage.KindConfig {
+		return nil, s.err
+	}
+	return s.Storage.Get(account, name, kind)
+}
+
+type stubIssuingAccount struct {
+	lifetime time.Duration
+	caKey    *ecdsa.PrivateKey
+	ca       *x509.Certificate
+
+	mu       sync.Mutex
+	err      error
+	issued   int
+	replaced []string
+}
+
+func newStubIssuingAccount(lifetime time.Duration) *stubIssuingAccount {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		panic(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	return &stubIssuingAccount{lifetime: lifetime, caKey: key, ca: ca}
+}
+
+func (ia *stubIssuingAccount) AuthorizeIdentity(id acme.Identifier) (*acme.Authorization, error) {
+	return &acme.Authorization{Status: protocol.StatusValid, Identifier: id}, nil
+}
+
+func (ia *stubIssuingAccount) Authorization(uri string) (*acme.Authorization, error) {
+	return nil, fmt.Errorf("unexpected Authorization(%q)", uri)
+}
+
+func (ia *stubIssuingAccount) ValidateChallenge(uri string, resp protocol.Response) (protocol.Challenge, error) {
+	return nil, fmt.Errorf("unexpected ValidateChallenge(%q)", uri)
+}
+
+func (ia *stubIssuingAccount) ReplaceCertificate(csr []byte, certID string) (*acme.Certificate, error) {
+	ia.mu.Lock()
+	ia.replaced = append(ia.replaced, certID)
+	ia.mu.Unlock()
+
+	return ia.IssueCertificate(csr)
+}
+
+func (ia *stubIssuingAccount) IssueCertificate(csr []byte) (*acme.Certificate, error) {
+	ia.mu.Lock()
+	defer ia.mu.Unlock()
+
+	if ia.err != nil {
+		return nil, ia.err
+	}
+	req, err := x509.ParseCertificateRequest(csr)
+	if err != nil {
+		return nil, err
+	}
+	ia.issued++
+	notBefore := time.Now().Truncate(time.Second)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(ia.issued + 1)),
+		Subject:      req.Subject,
+		DNSNames:     req.DNSNames,
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(ia.lifetime),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ia.ca, req.PublicKey, ia.caKey)
+	if err != nil {
+		return nil, err
+	}
+	return &acme.Certificate{Bytes: der}, nil
+}
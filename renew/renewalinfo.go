@@ -0,0 +1,33 @@
+package renew
+
+import (
+	"crypto/x509"
+	"time"
+
+	"github.com/tommie/acme-go"
+)
+
+// A RenewalInfoFetcher can fetch ACME Renewal Information. A
+// *acme.ClientAccount fulfills this interface.
+type RenewalInfoFetcher interface {
+	RenewalInfo(cert *x509.Certificate) (*acme.RenewalInfo, error)
+}
+
+// RenewalInfoWindow returns a WindowFunc using the server's ACME
+// Renewal Information (RFC 9773). The window is checked again when
+// the server's Retry-After has passed, so certificates are renewed
+// early if the server moves the window, e.g. before a mass
+// revocation.
+func RenewalInfoWindow(f RenewalInfoFetcher) WindowFunc {
+	return func(name string, cert *x509.Certificate) (*Window, error) {
+		ri, err := f.RenewalInfo(cert)
+		if err != nil {
+			return nil, err
+		}
+		return &Window{
+			Start:     ri.Start,
+			End:       ri.End,
+			NextCheck: time.Now().Add(ri.RetryAfter),
+		}, nil
+	}
+}
@@ -0,0 +1,140 @@
+package renew
+
+import (
+	"crypto/x509"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tommie/acme-go"
+	"github.com/tommie/acme-go/storage"
+)
+
+func TestRenewalInfoWindow(t *testing.T) {
+	start := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	f := stubRenewalInfoFetcher(func(cert *x509.Certificate) (*acme.RenewalInfo, error) {
+		return &acme.RenewalInfo{Start: start, End: start.Add(time.Hour), RetryAfter: time.Hour}, nil
+	})
+
+	before := time.Now()
+	got, err := RenewalInfoWindow(f)("example", &x509.Certificate{})
+	if err != nil {
+		t.Fatalf("RenewalInfoWindow failed: %v", err)
+	}
+	if !got.Start.Equal(start) || !got.End.Equal(start.Add(time.Hour)) {
+		t.Errorf("RenewalInfoWindow: got %v-%v, want %v-%v", got.Start, got.End, start, start.Add(time.Hour))
+	}
+	if got.NextCheck.Before(before.Add(time.Hour)) || got.NextCheck.After(time.Now().Add(time.Hour)) {
+		t.Errorf("RenewalInfoWindow NextCheck: got %v, want about an hour from now", got.NextCheck)
+	}
+}
+
+func TestManagerRenewalInfo(t *testing.T) {
+	s := mustNewStorage(t)
+	ia := newStubIssuingAccount(90 * 24 * time.Hour)
+	now := time.Now().Truncate(time.Second)
+	win := &Window{Start: now.Add(48 * time.Hour), End: now.Add(72 * time.Hour), NextCheck: now.Add(time.Hour)}
+	m := NewManager(s, "acct", acme.NewCertificateIssuer(ia), acme.TypeSolver{}, nil, WithRenewalWindow(func(name string, cert *x509.Certificate) (*Window, error) {
+		return win, nil
+	}))
+	m.now = func() time.Time { return now }
+	if err := m.Manage("example", []string{"example.com"}); err != nil {
+		t.Fatalf("Manage failed: %v", err)
+	}
+	if err := m.Renew("example"); err != nil {
+		t.Fatalf("Renew failed: %v", err)
+	}
+	st := m.Status()[0]
+	if got, want := st.NextRenewal, win.NextCheck; !got.Equal(want) {
+		t.Errorf("Status NextRenewal: got %v, want %v", got, want)
+	}
+	if st.RenewalTime.Before(win.Start) || st.RenewalTime.After(win.End) {
+		t.Errorf("Status RenewalTime: got %v, want in %v-%v", st.RenewalTime, win.Start, win.End)
+	}
+	renewAt := st.RenewalTime
+
+	// The window hasn't moved, so the check neither renews nor
+	// chooses a new time.
+	now = win.NextCheck
+	win = &Window{Start: win.Start, End: win.End, NextCheck: now.Add(time.Hour)}
+	if err := m.renew("example", false); err != nil {
+		t.Fatalf("renew failed: %v", err)
+	}
+	if ia.issued != 1 {
+		t.Errorf("renew issued: got %d, want 1", ia.issued)
+	}
+	st = m.Status()[0]
+	if !st.RenewalTime.Equal(renewAt) {
+		t.Errorf("Status RenewalTime: got %v, want %v", st.RenewalTime, renewAt)
+	}
+	if !st.NextCheck.Equal(win.NextCheck) {
+		t.Errorf("Status NextCheck: got %v, want %v", st.NextCheck, win.NextCheck)
+	}
+
+	// The server moved the window into the past, e.g. before a
+	// revocation, so the check renews and tells the server which
+	// certificate is replaced.
+	old, err := storage.GetBundle(s, "acct", "example")
+	if err != nil {
+		t.Fatalf("GetBundle failed: %v", err)
+	}
+	oldLeaf, err := x509.ParseCertificate(old.Certificate)
+	if err != nil {
+		t.Fatalf("ParseCertificate failed: %v", err)
+	}
+	wantID, err := acme.CertID(oldLeaf)
+	if err != nil {
+		t.Fatalf("CertID failed: %v", err)
+	}
+
+	now = win.NextCheck
+	win = &Window{Start: now.Add(-time.Hour), End: now.Add(-time.Minute)}
+	if err := m.renew("example", false); err != nil {
+		t.Fatalf("renew failed: %v", err)
+	}
+	if ia.issued != 2 {
+		t.Errorf("renew issued: got %d, want 2", ia.issued)
+	}
+	if want := []string{wantID}; !reflect.DeepEqual(ia.replaced, want) {
+		t.Errorf("renew replaced: got %v, want %v", ia.replaced, want)
+	}
+}
+
+func TestManagerRenewalTime(t *testing.T) {
+	s := mustNewStorage(t)
+	ia := newStubIssuingAccount(90 * 24 * time.Hour)
+	now := time.Now().Truncate(time.Second)
+	calls := 0
+	m := NewManager(s, "acct", acme.NewCertificateIssuer(ia), acme.TypeSolver{}, nil, WithRenewalWindow(func(name string, cert *x509.Certificate) (*Window, error) {
+		calls++
+		return &Window{Start: now.Add(time.Hour), End: now.Add(48 * time.Hour), NextCheck: now.Add(72 * time.Hour)}, nil
+	}))
+	m.now = func() time.Time { return now }
+	if err := m.Manage("example", []string{"example.com"}); err != nil {
+		t.Fatalf("Manage failed: %v", err)
+	}
+	if err := m.Renew("example"); err != nil {
+		t.Fatalf("Renew failed: %v", err)
+	}
+	calls = 0
+
+	// When the chosen time is reached, the certificate is renewed
+	// without fetching the window again.
+	now = m.Status()[0].RenewalTime
+	if err := m.renew("example", false); err != nil {
+		t.Fatalf("renew failed: %v", err)
+	}
+	if ia.issued != 2 {
+		t.Errorf("renew issued: got %d, want 2", ia.issued)
+	}
+	// The only call is for the new certificate.
+	if calls != 1 {
+		t.Errorf("window calls: got %d, want 1", calls)
+	}
+}
+
+type stubRenewalInfoFetcher func(cert *x509.Certificate) (*acme.RenewalInfo, error)
+
+func (f stubRenewalInfoFetcher) RenewalInfo(cert *x509.Certificate) (*acme.RenewalInfo, error) {
+	return f(cert)
+}
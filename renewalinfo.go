@@ -0,0 +1,104 @@
+package acme
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tommie/acme-go/protocol"
+)
+
+var (
+	ErrNoAuthorityKeyID = errors.New("certificate has no authority key identifier")
+)
+
+// DefaultRenewalInfoRetryAfter is how long renewal information is
+// considered current if the server doesn't send Retry-After.
+const DefaultRenewalInfoRetryAfter = 6 * time.Hour
+
+// RenewalInfo is the renewal window a server suggests for a
+// certificate. RFC 9773.
+type RenewalInfo struct {
+	// Start and End delimit the suggested window. A window in the
+	// past means the certificate should be renewed immediately,
+	// e.g. because it will be revoked.
+	Start, End time.Time
+
+	// ExplanationURL optionally points to a description of why
+	// the window was set, e.g. an incident report.
+	ExplanationURL string
+
+	// RetryAfter is how long to wait before fetching the
+	// information again.
+	RetryAfter time.Duration
+}
+
+// CertID returns the unique identifier of a certificate used in
+// renewal information requests and replacement orders. It is made
+// from the authority key identifier and serial number. RFC 9773
+// Section 4.1.
+func CertID(cert *x509.Certificate) (string, error) {
+	if len(cert.AuthorityKeyId) == 0 {
+		return "", ErrNoAuthorityKeyID
+	}
+
+	// The serial is the DER encoded INTEGER contents, which may
+	// have a leading zero byte that big.Int.Bytes drops.
+	bs, err := asn1.Marshal(cert.SerialNumber)
+	if err != nil {
+		return "", err
+	}
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(bs, &raw); err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(cert.AuthorityKeyId) + "." + enc.EncodeToString(raw.Bytes), nil
+}
+
+// RenewalInfo fetches the suggested renewal window of a certificate.
+// Returns ErrUnsupported if the server doesn't provide renewal
+// information.
+func (a *ClientAccount) RenewalInfo(cert *x509.Certificate) (*RenewalInfo, error) {
+	id, err := CertID(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := a.directory()
+	if err != nil {
+		return nil, err
+	}
+	if d.RenewalInfo == "" {
+		return nil, ErrUnsupported
+	}
+
+	ri, resp, err := protocol.GetRenewalInfo(a.http, strings.TrimSuffix(d.RenewalInfo, "/")+"/"+id)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get renewal info: unexpected HTTP status: %s", resp.Status)
+	}
+
+	start, end := time.Time(ri.SuggestedWindow.Start), time.Time(ri.SuggestedWindow.End)
+	if !end.After(start) {
+		return nil, fmt.Errorf("get renewal info: invalid window: %v to %v", start, end)
+	}
+
+	ra, _ := retryAfter(resp.Header, DefaultRenewalInfoRetryAfter)
+
+	return &RenewalInfo{
+		Start:          start,
+		End:            end,
+		ExplanationURL: ri.ExplanationURL,
+		RetryAfter:     ra,
+	}, nil
+}
@@ -0,0 +1,169 @@
+package acme
+
+import (
+	"crypto/x509"
+	"math/big"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tommie/acme-go/protocol"
+)
+
+func TestCertID(t *testing.T) {
+	// The example from RFC 9773 Section 4.1.
+	cert := &x509.Certificate{
+		AuthorityKeyId: []byte{0x69, 0x88, 0x5B, 0x6B, 0x87, 0x46, 0x40, 0x41, 0xE1, 0xB3, 0x7B, 0x84, 0x7B, 0xA0, 0xAE, 0x2C, 0xDE, 0x01, 0xC8, 0xD4},
+		SerialNumber:   big.NewInt(0x87654321),
+	}
+	got, err := CertID(cert)
+	if err != nil {
+		t.Fatalf("CertID failed: %v", err)
+	}
+	if want := "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE"; got != want {
+		t.Errorf("CertID: got %q, want %q", got, want)
+	}
+
+	if _, err := CertID(&x509.Certificate{SerialNumber: big.NewInt(1)}); err != ErrNoAuthorityKeyID {
+		t.Errorf("CertID(no AKI): got %v, want %v", err, ErrNoAuthorityKeyID)
+	}
+}
+
+func TestClientAccountRenewalInfo(t *testing.T) {
+	start := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	cert := &x509.Certificate{AuthorityKeyId: []byte{1, 2}, SerialNumber: big.NewInt(3)}
+
+	tsts := []struct {
+		Name       string
+		RetryAfter []string
+		Want       time.Duration
+	}{
+		{"seconds", []string{"3600"}, time.Hour},
+		{"default", nil, DefaultRenewalInfoRetryAfter},
+	}
+	for _, tst := range tsts {
+		a, hc := newTestClientAccount()
+		dir := hc.getters["/"]
+		hc.getters["/"] = func(accept string, respBody interface{}) (*http.Response, error) {
+			resp, err := dir(accept, respBody)
+			respBody.(*protocol.Directory).RenewalInfo = "/renewal-info/"
+			return resp, err
+		}
+		hc.getters["/renewal-info/AQI.Aw"] = func(accept string, respBody interface{}) (*http.Response, error) {
+			ri := respBody.(*protocol.RenewalInfo)
+			ri.SuggestedWindow = protocol.SuggestedWindow{Start: protocol.Time(start), End: protocol.Time(end)}
+			ri.ExplanationURL = "http://example.com/incident"
+
+			hdr := http.Header{}
+			if tst.RetryAfter != nil {
+				hdr[protocol.RetryAfter] = tst.RetryAfter
+			}
+			return &http.Response{StatusCode: http.StatusOK, Header: hdr}, nil
+		}
+
+		got, err := a.RenewalInfo(cert)
+		if err != nil {
+			t.Fatalf("[%s] RenewalInfo failed: %v", tst.Name, err)
+		}
+		want := &RenewalInfo{Start: start, End: end, ExplanationURL: "http://example.com/incident", RetryAfter: tst.Want}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("[%s] RenewalInfo: got %+v, want %+v", tst.Name, got, want)
+		}
+	}
+}
+
+func TestClientAccountRenewalInfoUnsupported(t *testing.T) {
+	a, _ := newTestClientAccount()
+	cert := &x509.Certificate{AuthorityKeyId: []byte{1, 2}, SerialNumber: big.NewInt(3)}
+	if _, err := a.RenewalInfo(cert); err != ErrUnsupported {
+		t.Errorf("RenewalInfo: got %v, want %v", err, ErrUnsupported)
+	}
+}
+
+func TestClientAccountReplaceCertificate(t *testing.T) {
+	tsts := []struct {
+		Name        string
+		RenewalInfo string
+		Want        string
+	}{
+		{"ari", "/renewal-info/", "AQI.Aw"},
+		{"noARI", "", ""},
+	}
+	for _, tst := range tsts {
+		a, hc := newTestClientAccount()
+		dir := hc.getters["/"]
+		hc.getters["/"] = func(accept string, respBody interface{}) (*http.Response, error) {
+			resp, err := dir(accept, respBody)
+			respBody.(*protocol.Directory).RenewalInfo = tst.RenewalInfo
+			return resp, err
+		}
+		hc.posters["/new-certificate"] = func(accept string, reqBody, respBody interface{}) (*http.Response, error) {
+			req := reqBody.(*protocol.CertificateIssuance)
+
+			if req.Replaces != tst.Want {
+				t.Errorf("[%s] ReplaceCertificate Replaces: got %q, want %q", tst.Name, req.Replaces, tst.Want)
+			}
+
+			*respBody.(*[]byte) = []byte("hello world")
+
+			return &http.Response{
+				StatusCode: http.StatusCreated,
+				Header:     http.Header{"Content-Location": []string{"http://example.com/cert/3"}},
+			}, nil
+		}
+
+		if _, err := a.ReplaceCertificate([]byte("my csr"), "AQI.Aw"); err != nil {
+			t.Fatalf("[%s] ReplaceCertificate failed: %v", tst.Name, err)
+		}
+	}
+}
+
+func TestCertificateIssuerReplacing(t *testing.T) {
+	var replaced string
+	ia := &stubReplacingAccount{
+		stubIssuingAccount: stubIssuingAccount{
+			authzID: func(id Identifier) (*Authorization, error) {
+				return &Authorization{Status: protocol.StatusValid}, nil
+			},
+			issue: func(csr []byte) (*Certificate, error) {
+				return &Certificate{URI: "http://example.com/cert/new"}, nil
+			},
+		},
+		replace: func(csr []byte, certID string) (*Certificate, error) {
+			replaced = certID
+			return &Certificate{URI: "http://example.com/cert/replacement"}, nil
+		},
+	}
+
+	ci := NewCertificateIssuer(ia)
+	got, err := ci.Replacing("AQI.Aw").AuthorizeAndIssue(testCSR, &stubSolver{})
+	if err != nil {
+		t.Fatalf("AuthorizeAndIssue failed: %v", err)
+	}
+	if want := "http://example.com/cert/replacement"; got.URI != want {
+		t.Errorf("AuthorizeAndIssue URI: got %q, want %q", got.URI, want)
+	}
+	if want := "AQI.Aw"; replaced != want {
+		t.Errorf("AuthorizeAndIssue replaced: got %q, want %q", replaced, want)
+	}
+
+	// The original issuer is unaffected.
+	got, err = ci.AuthorizeAndIssue(testCSR, &stubSolver{})
+	if err != nil {
+		t.Fatalf("AuthorizeAndIssue failed: %v", err)
+	}
+	if want := "http://example.com/cert/new"; got.URI != want {
+		t.Errorf("AuthorizeAndIssue URI: got %q, want %q", got.URI, want)
+	}
+}
+
+type stubReplacingAccount struct {
+	stubIssuingAccount
+	replace func(csr []byte, certID string) (*Certificate, error)
+}
+
+func (ia *stubReplacingAccount) ReplaceCertificate(csr []byte, certID string) (*Certificate, error) {
+	return ia.replace(csr, certID)
+}
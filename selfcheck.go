@@ -0,0 +1,201 @@
+package acme
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tommie/acme-go/protocol"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// A SelfChecker verifies that a solved challenge is visible from the
+// outside, before the ACME server is asked to validate it. Failing
+// locally avoids counting towards the server's failed validation
+// rate limits.
+type SelfChecker interface {
+	// SelfCheck returns nil if the response to the challenge for
+	// the identifier is in place.
+	SelfCheck(id Identifier, c protocol.Challenge, resp protocol.Response) error
+}
+
+// A SelfCheckError is returned by CertificateIssuer if a self-check
+// fails.
+type SelfCheckError struct {
+	Identifier Identifier
+	Type       protocol.ChallengeType
+	Err        error
+}
+
+func (e *SelfCheckError) Error() string {
+	return fmt.Sprintf("self-check of %s for %s failed: %v", e.Type, e.Identifier, e.Err)
+}
+
+// A TypeSelfChecker is a SelfChecker split by challenge type.
+// Challenges of types without a checker always pass.
+type TypeSelfChecker map[protocol.ChallengeType]SelfChecker
+
+func (sc TypeSelfChecker) SelfCheck(id Identifier, c protocol.Challenge, resp protocol.Response) error {
+	s, ok := sc[c.GetType()]
+	if !ok {
+		return nil
+	}
+	return s.SelfCheck(id, c, resp)
+}
+
+// An HTTP01SelfChecker fetches the http-01 resource on port 80, like
+// the ACME server would, and compares it to the key authorization.
+type HTTP01SelfChecker struct {
+	client *http.Client
+}
+
+// NewHTTP01SelfChecker creates a new checker using the given HTTP
+// client. If client is nil, a client with a ten second timeout is
+// used. Redirects are followed as configured in the client.
+func NewHTTP01SelfChecker(client *http.Client) *HTTP01SelfChecker {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &HTTP01SelfChecker{client}
+}
+
+func (sc *HTTP01SelfChecker) SelfCheck(id Identifier, c protocol.Challenge, resp protocol.Response) error {
+	hc, ok := c.(*protocol.HTTP01Challenge)
+	if !ok {
+		return fmt.Errorf("not a http-01 challenge: %s", c.GetType())
+	}
+	hresp, ok := resp.(*protocol.HTTP01Response)
+	if !ok {
+		return fmt.Errorf("not a http-01 response: %s", resp.GetType())
+	}
+	dnsID, ok := id.(DNSIdentifier)
+	if !ok {
+		return fmt.Errorf("http-01 cannot validate identifier %v", id)
+	}
+
+	u := "http://" + string(dnsID) + protocol.HTTP01BasePath + "/" + hc.Token
+	r, err := sc.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected HTTP status: %s", u, r.Status)
+	}
+	// A key authorization is well below this limit.
+	bs, err := io.ReadAll(io.LimitReader(r.Body, 1024))
+	if err != nil {
+		return err
+	}
+	if got := strings.TrimSpace(string(bs)); got != hresp.KeyAuthorization {
+		return fmt.Errorf("GET %s: got key authorization %q, want %q", u, got, hresp.KeyAuthorization)
+	}
+
+	return nil
+}
+
+const (
+	// TLSALPN01Protocol is the ALPN protocol name used for
+	// tls-alpn-01 validation.
+	TLSALPN01Protocol = "acme-tls/1"
+)
+
+// idPEACMEIdentifier is the X.509 extension holding the tls-alpn-01
+// validation value.
+var idPEACMEIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// A TLSALPN01SelfChecker connects to the identifier with the
+// acme-tls/1 protocol and inspects the presented certificate.
+type TLSALPN01SelfChecker struct {
+	key    *jose.JSONWebKey
+	port   string
+	dialer *net.Dialer
+}
+
+// NewTLSALPN01SelfChecker creates a new checker. The key is the
+// account key, used to compute the expected validation value. port
+// is the port to connect to; if empty, 443 is used.
+func NewTLSALPN01SelfChecker(key *jose.JSONWebKey, port string) *TLSALPN01SelfChecker {
+	if port == "" {
+		port = "443"
+	}
+	return &TLSALPN01SelfChecker{
+		key:    key,
+		port:   port,
+		dialer: &net.Dialer{Timeout: 10 * time.Second},
+	}
+}
+
+func (sc *TLSALPN01SelfChecker) SelfCheck(id Identifier, c protocol.Challenge, resp protocol.Response) error {
+	tc, ok := c.(*protocol.TLSALPN01Challenge)
+	if !ok {
+		return fmt.Errorf("not a tls-alpn-01 challenge: %s", c.GetType())
+	}
+	dnsID, ok := id.(DNSIdentifier)
+	if !ok {
+		return fmt.Errorf("tls-alpn-01 cannot validate identifier %v", id)
+	}
+
+	want, err := protocol.TLSALPN01Validation(tc.Token, sc.key)
+	if err != nil {
+		return err
+	}
+
+	conn, err := tls.DialWithDialer(sc.dialer, "tcp", net.JoinHostPort(string(dnsID), sc.port), &tls.Config{
+		ServerName: string(dnsID),
+		NextProtos: []string{TLSALPN01Protocol},
+		// The certificate is self-signed by design.
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	st := conn.ConnectionState()
+	if st.NegotiatedProtocol != TLSALPN01Protocol {
+		return fmt.Errorf("negotiated protocol %q, want %q", st.NegotiatedProtocol, TLSALPN01Protocol)
+	}
+	if len(st.PeerCertificates) == 0 {
+		return fmt.Errorf("no certificate presented")
+	}
+
+	return checkTLSALPN01Certificate(st.PeerCertificates[0], string(dnsID), want)
+}
+
+// checkTLSALPN01Certificate verifies that cert is a valid
+// tls-alpn-01 certificate for name with the given validation value.
+func checkTLSALPN01Certificate(cert *x509.Certificate, name string, want []byte) error {
+	if len(cert.DNSNames) != 1 || !strings.EqualFold(cert.DNSNames[0], name) {
+		return fmt.Errorf("certificate names %v, want [%s]", cert.DNSNames, name)
+	}
+
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(idPEACMEIdentifier) {
+			continue
+		}
+		if !ext.Critical {
+			return fmt.Errorf("acmeIdentifier extension is not critical")
+		}
+		var got []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &got); err != nil {
+			return err
+		} else if len(rest) > 0 {
+			return fmt.Errorf("trailing data in acmeIdentifier extension")
+		}
+		if !bytes.Equal(got, want) {
+			return fmt.Errorf("acmeIdentifier mismatch")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("no acmeIdentifier extension in certificate")
+}
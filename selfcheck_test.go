@@ -0,0 +1,168 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tommie/acme-go/protocol"
+)
+
+func TestTypeSelfCheckerSelfCheck(t *testing.T) {
+	sc := TypeSelfChecker{
+		protocol.ChallengeHTTP01: stubSelfChecker{errors.New("mock error")},
+	}
+
+	if err := sc.SelfCheck(DNSIdentifier("example.com"), &protocol.DNS01Challenge{Type: protocol.ChallengeDNS01}, nil); err != nil {
+		t.Errorf("SelfCheck(dns-01) failed: %v", err)
+	}
+	if err := sc.SelfCheck(DNSIdentifier("example.com"), &protocol.HTTP01Challenge{Type: protocol.ChallengeHTTP01}, nil); err == nil {
+		t.Errorf("SelfCheck(http-01): got success, want error")
+	}
+}
+
+func TestHTTP01SelfCheckerSelfCheck(t *testing.T) {
+	hts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "example.com" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Path {
+		case protocol.HTTP01BasePath + "/tok":
+			fmt.Fprintln(w, "tok.thumb")
+		case protocol.HTTP01BasePath + "/other":
+			fmt.Fprint(w, "other.thumb")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer hts.Close()
+
+	// Send all requests to the test server, regardless of host.
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, hts.Listener.Addr().String())
+		},
+	}}
+	sc := NewHTTP01SelfChecker(client)
+
+	tsts := []struct {
+		name  string
+		id    Identifier
+		token string
+
+		err error
+	}{
+		{name: "ok", id: DNSIdentifier("example.com"), token: "tok"},
+		{name: "mismatch", id: DNSIdentifier("example.com"), token: "other", err: fmt.Errorf("GET http://example.com")},
+		{name: "missing", id: DNSIdentifier("example.com"), token: "missing", err: fmt.Errorf("GET http://example.com")},
+		{name: "host", id: DNSIdentifier("www.example.com"), token: "tok", err: fmt.Errorf("GET http://www.example.com")},
+	}
+
+	for _, tst := range tsts {
+		c := &protocol.HTTP01Challenge{Type: protocol.ChallengeHTTP01, Token: tst.token}
+		resp := &protocol.HTTP01Response{Type: protocol.ChallengeHTTP01, KeyAuthorization: "tok.thumb"}
+		err := sc.SelfCheck(tst.id, c, resp)
+		if !matchError(err, tst.err) {
+			t.Errorf("[%s] SelfCheck failed: got %v, want prefix %v", tst.name, err, tst.err)
+		}
+	}
+}
+
+func TestTLSALPN01SelfCheckerSelfCheck(t *testing.T) {
+	want, err := protocol.TLSALPN01Validation("tok", testJWK)
+	if err != nil {
+		t.Fatalf("TLSALPN01Validation failed: %v", err)
+	}
+
+	tsts := []struct {
+		name   string
+		value  []byte
+		protos []string
+
+		err error
+	}{
+		{name: "ok", value: want, protos: []string{TLSALPN01Protocol}},
+		{name: "mismatch", value: []byte("other"), protos: []string{TLSALPN01Protocol}, err: fmt.Errorf("acmeIdentifier mismatch")},
+		{name: "protocol", value: want, err: fmt.Errorf("negotiated protocol")},
+	}
+
+	for _, tst := range tsts {
+		port := startTLSALPN01Server(t, "localhost", tst.value, tst.protos)
+		sc := NewTLSALPN01SelfChecker(testJWK, port)
+		c := &protocol.TLSALPN01Challenge{Type: protocol.ChallengeTLSALPN01, Token: "tok"}
+		err := sc.SelfCheck(DNSIdentifier("localhost"), c, &protocol.TLSALPN01Response{Type: protocol.ChallengeTLSALPN01})
+		if !matchError(err, tst.err) {
+			t.Errorf("[%s] SelfCheck failed: got %v, want prefix %v", tst.name, err, tst.err)
+		}
+	}
+}
+
+type stubSelfChecker struct {
+	err error
+}
+
+func (sc stubSelfChecker) SelfCheck(id Identifier, c protocol.Challenge, resp protocol.Response) error {
+	return sc.err
+}
+
+// startTLSALPN01Server starts a TLS server on a local port presenting
+// a tls-alpn-01 certificate for name. Returns the port.
+func startTLSALPN01Server(t *testing.T, name string, value []byte, protos []string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	ext, err := asn1.Marshal(value)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: name},
+		DNSNames:        []string{name},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: idPEACMEIdentifier, Critical: true, Value: ext}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+
+	l, err := tls.Listen("tcp", "localhost:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   protos,
+	})
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return port
+}
@@ -240,8 +240,8 @@ func BoulderDirectory(root *url.URL) *protocol.Directory {
 // RegisterBoulderHTTP registers the given server under the http.ServeMux h
 // with Boulder-compatible paths. The root URI must be absolute and point to
 // the root of h.
-func RegisterBoulderHTTP(h protocol.HTTPHandlerHandler, root *url.URL, s Server, ns protocol.NonceSource) {
-	protocol.RegisterBoulderHTTP(h, NewHTTPServer(s, BoulderDirectory(root)), ns)
+func RegisterBoulderHTTP(h protocol.HTTPHandlerHandler, root *url.URL, s Server, ns protocol.NonceSource, opts ...protocol.HTTPDispatcherOpt) {
+	protocol.RegisterBoulderHTTP(h, NewHTTPServer(s, BoulderDirectory(root)), ns, opts...)
 }
 
 // addLink adds a Link header.
@@ -0,0 +1,218 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+var (
+	ErrUnsupportedKey = errors.New("unsupported key type")
+)
+
+// opaqueSigner is a jose.OpaqueSigner signing with a crypto.Signer,
+// e.g. a key held in a KMS or HSM.
+type opaqueSigner struct {
+	s   crypto.Signer
+	alg jose.SignatureAlgorithm
+	jwk *jose.JSONWebKey
+}
+
+// NewOpaqueSigner returns a signer for JWS using s with the given
+// algorithm. If alg is empty, it is chosen from the public key. The
+// result can be used as an account key for NewClientAccount and
+// RegisterAccount. Keys that are not *ecdsa.PrivateKey,
+// *rsa.PrivateKey or ed25519.PrivateKey are wrapped automatically.
+func NewOpaqueSigner(s crypto.Signer, alg jose.SignatureAlgorithm) (jose.OpaqueSigner, error) {
+	pub := s.Public()
+	if alg == "" {
+		alg = publicKeyAlgo(pub)
+		if alg == "" {
+			return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, pub)
+		}
+	}
+	if _, err := signatureHash(pub, alg); err != nil {
+		return nil, err
+	}
+
+	return &opaqueSigner{
+		s:   s,
+		alg: alg,
+		jwk: &jose.JSONWebKey{Key: pub},
+	}, nil
+}
+
+func (s *opaqueSigner) Public() *jose.JSONWebKey {
+	return s.jwk
+}
+
+func (s *opaqueSigner) Algs() []jose.SignatureAlgorithm {
+	return []jose.SignatureAlgorithm{s.alg}
+}
+
+func (s *opaqueSigner) SignPayload(payload []byte, alg jose.SignatureAlgorithm) ([]byte, error) {
+	if alg != s.alg {
+		return nil, jose.ErrUnsupportedAlgorithm
+	}
+	h, err := signatureHash(s.jwk.Key, alg)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts crypto.SignerOpts = h
+	digest := payload
+	if h != 0 {
+		hh := h.New()
+		hh.Write(payload)
+		digest = hh.Sum(nil)
+	}
+	switch alg {
+	case jose.PS256, jose.PS384, jose.PS512:
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: h}
+	}
+
+	sig, err := s.s.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if pub, ok := s.jwk.Key.(*ecdsa.PublicKey); ok {
+		// crypto.Signer returns ASN.1, but JWS wants R || S.
+		return ecdsaJWSSignature(sig, (pub.Curve.Params().BitSize+7)/8)
+	}
+	return sig, nil
+}
+
+// ecdsaJWSSignature converts an ASN.1 ECDSA signature to the
+// fixed-size concatenation used by JWS.
+func ecdsaJWSSignature(sig []byte, size int) ([]byte, error) {
+	var rs struct {
+		R, S *big.Int
+	}
+	if rest, err := asn1.Unmarshal(sig, &rs); err != nil {
+		return nil, err
+	} else if len(rest) > 0 {
+		return nil, errors.New("trailing data after ECDSA signature")
+	}
+
+	ret := make([]byte, 2*size)
+	rs.R.FillBytes(ret[:size])
+	rs.S.FillBytes(ret[size:])
+	return ret, nil
+}
+
+// signatureHash returns the hash used for the algorithm, after
+// checking it is compatible with the public key. EdDSA uses no
+// pre-hashing, and returns zero.
+func signatureHash(pub crypto.PublicKey, alg jose.SignatureAlgorithm) (crypto.Hash, error) {
+	var h crypto.Hash
+	var ok bool
+	switch alg {
+	case jose.RS256, jose.PS256:
+		_, ok = pub.(*rsa.PublicKey)
+		h = crypto.SHA256
+	case jose.RS384, jose.PS384:
+		_, ok = pub.(*rsa.PublicKey)
+		h = crypto.SHA384
+	case jose.RS512, jose.PS512:
+		_, ok = pub.(*rsa.PublicKey)
+		h = crypto.SHA512
+	case jose.ES256:
+		ok = publicKeyAlgo(pub) == alg
+		h = crypto.SHA256
+	case jose.ES384:
+		ok = publicKeyAlgo(pub) == alg
+		h = crypto.SHA384
+	case jose.ES512:
+		ok = publicKeyAlgo(pub) == alg
+		h = crypto.SHA512
+	case jose.EdDSA:
+		_, ok = pub.(ed25519.PublicKey)
+	default:
+		return 0, fmt.Errorf("%w: %s", jose.ErrUnsupportedAlgorithm, alg)
+	}
+	if !ok {
+		return 0, fmt.Errorf("%w: %s for %T", ErrUnsupportedKey, alg, pub)
+	}
+
+	return h, nil
+}
+
+// publicKeyAlgo returns the default JWS algorithm for a public key.
+// Returns a zero value if none exists.
+func publicKeyAlgo(pub crypto.PublicKey) jose.SignatureAlgorithm {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		// The curve must match the algorithm.
+		switch k.Curve.Params().BitSize {
+		case 256:
+			return jose.ES256
+		case 384:
+			return jose.ES384
+		case 521:
+			return jose.ES512
+		}
+
+	case *rsa.PublicKey:
+		// RS256 is the default in the letsencrypt client. PS256
+		// can be selected with a jose.SigningKey.
+		return jose.RS256
+
+	case ed25519.PublicKey:
+		return jose.EdDSA
+	}
+
+	return ""
+}
+
+// signingKey returns a JWS signing key for a private key. A
+// jose.SigningKey selects a non-default algorithm for its key. Keys
+// not natively supported by go-jose, but implementing crypto.Signer,
+// are wrapped with NewOpaqueSigner. The public key is also returned.
+func signingKey(key crypto.PrivateKey) (jose.SigningKey, crypto.PublicKey, error) {
+	alg := jose.SignatureAlgorithm("")
+	if sk, ok := key.(jose.SigningKey); ok {
+		key = sk.Key
+		alg = sk.Algorithm
+	}
+
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey, *rsa.PrivateKey, ed25519.PrivateKey:
+		pub := k.(crypto.Signer).Public()
+		if alg == "" {
+			alg = publicKeyAlgo(pub)
+		} else if _, err := signatureHash(pub, alg); err != nil {
+			return jose.SigningKey{}, nil, err
+		}
+		return jose.SigningKey{Algorithm: alg, Key: key}, pub, nil
+
+	case jose.OpaqueSigner:
+		algs := k.Algs()
+		if alg == "" && len(algs) > 0 {
+			alg = algs[0]
+		}
+		for _, a := range algs {
+			if a == alg {
+				return jose.SigningKey{Algorithm: alg, Key: k}, k.Public().Key, nil
+			}
+		}
+		return jose.SigningKey{}, nil, fmt.Errorf("%w: %s", jose.ErrUnsupportedAlgorithm, alg)
+
+	case crypto.Signer:
+		signer, err := NewOpaqueSigner(k, alg)
+		if err != nil {
+			return jose.SigningKey{}, nil, err
+		}
+		return jose.SigningKey{Algorithm: signer.Algs()[0], Key: signer}, k.Public(), nil
+	}
+
+	return jose.SigningKey{}, nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+}
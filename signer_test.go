@@ -0,0 +1,180 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/tommie/acme-go/protocol"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestNewOpaqueSigner(t *testing.T) {
+	p256 := mustGenerateECDSAKey()
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	// The test JWK is too small for PS256.
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	tsts := []struct {
+		Name    string
+		Key     crypto.Signer
+		Alg     jose.SignatureAlgorithm
+		WantAlg jose.SignatureAlgorithm
+	}{
+		{"P-256", p256, "", jose.ES256},
+		{"P-384", p384, "", jose.ES384},
+		{"P-521", p521, "", jose.ES512},
+		{"Ed25519", ed, "", jose.EdDSA},
+		{"RSA", rsaKey, "", jose.RS256},
+		{"RSA-PS256", rsaKey, jose.PS256, jose.PS256},
+		{"RSA-RS512", rsaKey, jose.RS512, jose.RS512},
+	}
+	for _, tst := range tsts {
+		signer, err := NewOpaqueSigner(opaqueKey{tst.Key}, tst.Alg)
+		if err != nil {
+			t.Fatalf("[%s] NewOpaqueSigner failed: %v", tst.Name, err)
+		}
+		if got := signer.Algs(); len(got) != 1 || got[0] != tst.WantAlg {
+			t.Errorf("[%s] Algs: got %v, want [%s]", tst.Name, got, tst.WantAlg)
+		}
+
+		s, err := jose.NewSigner(jose.SigningKey{Algorithm: tst.WantAlg, Key: signer}, nil)
+		if err != nil {
+			t.Fatalf("[%s] jose.NewSigner failed: %v", tst.Name, err)
+		}
+		jws, err := s.Sign([]byte("payload"))
+		if err != nil {
+			t.Fatalf("[%s] Sign failed: %v", tst.Name, err)
+		}
+		got, err := jws.Verify(tst.Key.Public())
+		if err != nil {
+			t.Errorf("[%s] Verify failed: %v", tst.Name, err)
+		} else if string(got) != "payload" {
+			t.Errorf("[%s] Verify: got %q, want %q", tst.Name, got, "payload")
+		}
+	}
+}
+
+func TestNewOpaqueSignerMismatch(t *testing.T) {
+	key := mustGenerateECDSAKey()
+	for _, alg := range []jose.SignatureAlgorithm{jose.ES384, jose.RS256, jose.EdDSA} {
+		if _, err := NewOpaqueSigner(key, alg); !errors.Is(err, ErrUnsupportedKey) {
+			t.Errorf("[%s] NewOpaqueSigner: got %v, want %v", alg, err, ErrUnsupportedKey)
+		}
+	}
+	if _, err := NewOpaqueSigner(key, jose.HS256); !errors.Is(err, jose.ErrUnsupportedAlgorithm) {
+		t.Errorf("NewOpaqueSigner(HS256): got %v, want %v", err, jose.ErrUnsupportedAlgorithm)
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	p256 := mustGenerateECDSAKey()
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	signer, err := NewOpaqueSigner(testJWK.Key.(crypto.Signer), jose.PS256)
+	if err != nil {
+		t.Fatalf("NewOpaqueSigner failed: %v", err)
+	}
+
+	tsts := []struct {
+		Name    string
+		Key     crypto.PrivateKey
+		WantAlg jose.SignatureAlgorithm
+	}{
+		{"rsa", testJWK.Key, jose.RS256},
+		{"rsa-PS256", jose.SigningKey{Algorithm: jose.PS256, Key: testJWK.Key}, jose.PS256},
+		{"P-256", p256, jose.ES256},
+		{"P-384", p384, jose.ES384},
+		{"P-521", p521, jose.ES512},
+		{"ed25519", ed, jose.EdDSA},
+		{"signer", opaqueKey{ed}, jose.EdDSA},
+		{"signer-P-256", jose.SigningKey{Algorithm: jose.ES256, Key: opaqueKey{p256}}, jose.ES256},
+		{"opaque", signer, jose.PS256},
+	}
+	for _, tst := range tsts {
+		sk, pub, err := signingKey(tst.Key)
+		if err != nil {
+			t.Fatalf("[%s] signingKey failed: %v", tst.Name, err)
+		}
+		if sk.Algorithm != tst.WantAlg {
+			t.Errorf("[%s] signingKey Algorithm: got %s, want %s", tst.Name, sk.Algorithm, tst.WantAlg)
+		}
+		if pub == nil {
+			t.Errorf("[%s] signingKey public key: got nil", tst.Name)
+		}
+	}
+
+	if _, _, err := signingKey("key"); !errors.Is(err, ErrUnsupportedKey) {
+		t.Errorf("signingKey(string): got %v, want %v", err, ErrUnsupportedKey)
+	}
+	if _, _, err := signingKey(jose.SigningKey{Algorithm: jose.ES384, Key: p256}); !errors.Is(err, ErrUnsupportedKey) {
+		t.Errorf("signingKey(P-256, ES384): got %v, want %v", err, ErrUnsupportedKey)
+	}
+	if _, _, err := signingKey(jose.SigningKey{Algorithm: jose.RS256, Key: signer}); !errors.Is(err, jose.ErrUnsupportedAlgorithm) {
+		t.Errorf("signingKey(opaque PS256, RS256): got %v, want %v", err, jose.ErrUnsupportedAlgorithm)
+	}
+}
+
+func TestRegisterAccountOpaqueSigner(t *testing.T) {
+	_, hts := newFakeACMEServer()
+	defer hts.Close()
+
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	p256 := mustGenerateECDSAKey()
+
+	for _, key := range []crypto.Signer{ed, opaqueKey{ed}, opaqueKey{p256}} {
+		a, _, err := RegisterAccount(hts.URL+protocol.DirectoryPath, key)
+		if err != nil {
+			t.Fatalf("[%T] RegisterAccount failed: %v", key, err)
+		}
+		if !publicKeysEqual(a.Key, key.Public()) {
+			t.Errorf("[%T] RegisterAccount Key: got %v, want %v", key, a.Key, key.Public())
+		}
+	}
+}
+
+// opaqueKey hides the concrete key type, like a KMS-backed signer.
+type opaqueKey struct {
+	s crypto.Signer
+}
+
+func (k opaqueKey) Public() crypto.PublicKey {
+	return k.s.Public()
+}
+
+func (k opaqueKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return k.s.Sign(rand, digest, opts)
+}
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/tommie/acme-go"
+)
+
+// A Bundle is a certificate with its private key and issuer chain.
+type Bundle struct {
+	Key         crypto.Signer
+	Certificate []byte
+	Chain       [][]byte
+}
+
+// PutBundle stores a bundle under a certificate name. The bundle is
+// replaced atomically as one item. The key, certificate, chain and
+// full chain are also stored as separate items for other programs,
+// e.g. web servers, but those are not replaced together.
+func PutBundle(s Storage, account, name string, b *Bundle) error {
+	der, err := x509.MarshalPKCS8PrivateKey(b.Key)
+	if err != nil {
+		return err
+	}
+	key := pemEncode("PRIVATE KEY", der)
+	cert := pemEncode("CERTIFICATE", b.Certificate)
+	var chain []byte
+	for _, c := range b.Chain {
+		chain = append(chain, pemEncode("CERTIFICATE", c)...)
+	}
+	fullchain := append(append([]byte(nil), cert...), chain...)
+
+	items := []struct {
+		kind Kind
+		data []byte
+	}{
+		{KindBundle, append(append([]byte(nil), key...), fullchain...)},
+		{KindKey, key},
+		{KindChain, chain},
+		{KindFullChain, fullchain},
+		{KindCertificate, cert},
+	}
+	for _, it := range items {
+		if err := s.Put(account, name, it.kind, it.data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetBundle loads a bundle stored with PutBundle. Returns
+// ErrKeyMismatch if the private key does not belong to the
+// certificate, and ErrBadBundle if the items cannot be parsed.
+func GetBundle(s Storage, account, name string) (*Bundle, error) {
+	bs, err := s.Get(account, name, KindBundle)
+	if err == ErrNotFound {
+		// Stored before bundles were kept as one item.
+		bs, err = getSeparateItems(s, account, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keyDER []byte
+	var certs [][]byte
+	for {
+		var pb *pem.Block
+		pb, bs = pem.Decode(bytes.TrimSpace(bs))
+		if pb == nil {
+			break
+		}
+		switch pb.Type {
+		case "PRIVATE KEY":
+			keyDER = pb.Bytes
+		case "CERTIFICATE":
+			certs = append(certs, pb.Bytes)
+		}
+	}
+	if keyDER == nil {
+		return nil, fmt.Errorf("%w: no private key in %s", ErrBadBundle, KindBundle)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%w: no certificate in %s", ErrBadBundle, KindBundle)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(keyDER)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadBundle, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported private key type %T", ErrBadBundle, key)
+	}
+	leaf, err := x509.ParseCertificate(certs[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadBundle, err)
+	}
+	if pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(leaf.PublicKey) {
+		return nil, ErrKeyMismatch
+	}
+
+	return &Bundle{
+		Key:         signer,
+		Certificate: certs[0],
+		Chain:       append([][]byte(nil), certs[1:]...),
+	}, nil
+}
+
+// getSeparateItems returns the key, certificate and chain items
+// concatenated, in the format of KindBundle.
+func getSeparateItems(s Storage, account, name string) ([]byte, error) {
+	var ret []byte
+	for _, kind := range []Kind{KindKey, KindCertificate, KindChain} {
+		bs, err := s.Get(account, name, kind)
+		if err != nil {
+			return nil, err
+		}
+		if kind == KindCertificate && len(pemDecodeAll(bs)) != 1 {
+			return nil, fmt.Errorf("%w: expected one certificate in %s", ErrBadBundle, KindCertificate)
+		}
+		ret = append(ret, bs...)
+		ret = append(ret, '\n')
+	}
+	return ret, nil
+}
+
+// A CertificateFetcher can fetch certificates by URI. A
+// *acme.ClientAccount fulfills this interface.
+type CertificateFetcher interface {
+	Certificate(uri string) (*acme.Certificate, error)
+}
+
+// An IssueOpt is an option for Issue.
+type IssueOpt func(*issueConfig)
+
+type issueConfig struct {
+	prev    []byte
+	prevSet bool
+}
+
+// WithPrevious sets the DER leaf certificate the caller expects to
+// replace, or nil if it expects none to be stored. By default, the
+// certificate stored when Issue is called is expected.
+func WithPrevious(cert []byte) IssueOpt {
+	return func(c *issueConfig) {
+		c.prev = cert
+		c.prevSet = true
+	}
+}
+
+// Issue authorizes and issues a certificate with the issuer, and
+// stores it as a bundle under the given name. The chain is fetched
+// with cf, unless nil.
+//
+// The name is locked while issuing. If the stored certificate is no
+// longer the expected one once the lock is held, another process has
+// renewed it, and that bundle is returned instead of issuing again.
+func Issue(s Storage, account, name string, ci *acme.CertificateIssuer, solver acme.Solver, cf CertificateFetcher, key crypto.Signer, csr []byte, opts ...IssueOpt) (*Bundle, error) {
+	var cfg issueConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if !cfg.prevSet {
+		b, err := storedBundle(s, account, name)
+		if err != nil {
+			return nil, err
+		}
+		if b != nil {
+			cfg.prev = b.Certificate
+		}
+	}
+
+	unlock, err := s.Lock(account, name)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	cur, err := storedBundle(s, account, name)
+	if err != nil {
+		return nil, err
+	}
+	if cur != nil && !bytes.Equal(cur.Certificate, cfg.prev) {
+		return cur, nil
+	}
+
+	cert, err := ci.AuthorizeAndIssue(csr, solver)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{Key: key, Certificate: cert.Bytes}
+	if cf != nil {
+		for _, uri := range cert.IssuerURIs {
+			ic, err := cf.Certificate(uri)
+			if err != nil {
+				return nil, err
+			}
+			b.Chain = append(b.Chain, ic.Bytes)
+		}
+	}
+
+	if err := PutBundle(s, account, name, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// storedBundle returns the stored bundle, or nil if there is none or
+// it is unusable because the key does not match or it cannot be
+// parsed. Issuing replaces an unusable bundle.
+func storedBundle(s Storage, account, name string) (*Bundle, error) {
+	b, err := GetBundle(s, account, name)
+	if err == ErrNotFound || err == ErrKeyMismatch || errors.Is(err, ErrBadBundle) {
+		return nil, nil
+	}
+	return b, err
+}
+
+func pemEncode(typ string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+}
+
+// pemDecodeAll returns the contents of all PEM blocks.
+func pemDecodeAll(bs []byte) [][]byte {
+	var ret [][]byte
+	for {
+		var b *pem.Block
+		b, bs = pem.Decode(bytes.TrimSpace(bs))
+		if b == nil {
+			return ret
+		}
+		ret = append(ret, b.Bytes)
+	}
+}
@@ -0,0 +1,312 @@
+package storage
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tommie/acme-go"
+	"github.com/tommie/acme-go/protocol"
+)
+
+func TestPutBundle(t *testing.T) {
+	s, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+	leaf, key := mustGenerateCertificate("example.com")
+	ca, _ := mustGenerateCertificate("ca.example.com")
+	want := &Bundle{Key: key, Certificate: leaf, Chain: [][]byte{ca}}
+
+	if err := PutBundle(s, "acct", "example.com", want); err != nil {
+		t.Fatalf("PutBundle failed: %v", err)
+	}
+	got, err := GetBundle(s, "acct", "example.com")
+	if err != nil {
+		t.Fatalf("GetBundle failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetBundle: got %+v, want %+v", got, want)
+	}
+
+	fullchain, err := s.Get("acct", "example.com", KindFullChain)
+	if err != nil {
+		t.Fatalf("Get(fullchain) failed: %v", err)
+	}
+	if got := pemDecodeAll(fullchain); !reflect.DeepEqual(got, [][]byte{leaf, ca}) {
+		t.Errorf("Get(fullchain): got %d certificates, want 2", len(got))
+	}
+}
+
+func TestGetBundleKeyMismatch(t *testing.T) {
+	s, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+	leaf, _ := mustGenerateCertificate("example.com")
+	_, otherKey := mustGenerateCertificate("example.com")
+
+	if err := PutBundle(s, "acct", "example.com", &Bundle{Key: otherKey, Certificate: leaf}); err != nil {
+		t.Fatalf("PutBundle failed: %v", err)
+	}
+	if _, err := GetBundle(s, "acct", "example.com"); err != ErrKeyMismatch {
+		t.Errorf("GetBundle: got %v, want %v", err, ErrKeyMismatch)
+	}
+}
+
+func TestGetBundleSeparateItems(t *testing.T) {
+	s, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+	leaf, key := mustGenerateCertificate("example.com")
+	ca, _ := mustGenerateCertificate("ca.example.com")
+	want := &Bundle{Key: key, Certificate: leaf, Chain: [][]byte{ca}}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey failed: %v", err)
+	}
+
+	// A bundle stored without KindBundle is still found.
+	for kind, data := range map[Kind][]byte{
+		KindKey:         pemEncode("PRIVATE KEY", der),
+		KindCertificate: pemEncode("CERTIFICATE", leaf),
+		KindChain:       pemEncode("CERTIFICATE", ca),
+	} {
+		if err := s.Put("acct", "example.com", kind, data); err != nil {
+			t.Fatalf("Put(%s) failed: %v", kind, err)
+		}
+	}
+	got, err := GetBundle(s, "acct", "example.com")
+	if err != nil {
+		t.Fatalf("GetBundle failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetBundle: got %+v, want %+v", got, want)
+	}
+
+	// A new key with the old certificate is rejected.
+	_, otherKey := mustGenerateCertificate("example.com")
+	der, err = x509.MarshalPKCS8PrivateKey(otherKey)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey failed: %v", err)
+	}
+	if err := s.Put("acct", "example.com", KindKey, pemEncode("PRIVATE KEY", der)); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := GetBundle(s, "acct", "example.com"); err != ErrKeyMismatch {
+		t.Errorf("GetBundle: got %v, want %v", err, ErrKeyMismatch)
+	}
+}
+
+func TestIssue(t *testing.T) {
+	s, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+	leaf, key := mustGenerateCertificate("example.com")
+	ca, _ := mustGenerateCertificate("ca.example.com")
+	ia := &stubIssuingAccount{
+		cert: &acme.Certificate{Bytes: leaf, URI: "http://example.com/cert/1", IssuerURIs: []string{"http://example.com/ca"}},
+		certs: map[string]*acme.Certificate{
+			"http://example.com/ca": {Bytes: ca},
+		},
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{"example.com"}}, key)
+	if err != nil {
+		t.Fatalf("CreateCertificateRequest failed: %v", err)
+	}
+
+	got, err := Issue(s, "acct", "example.com", acme.NewCertificateIssuer(ia), acme.TypeSolver{}, ia, key, csr)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	want := &Bundle{Key: key, Certificate: leaf, Chain: [][]byte{ca}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Issue: got %+v, want %+v", got, want)
+	}
+	if _, err := GetBundle(s, "acct", "example.com"); err != nil {
+		t.Errorf("GetBundle failed: %v", err)
+	}
+}
+
+func TestIssueBadBundle(t *testing.T) {
+	s, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+	if err := s.Put("acct", "example.com", KindBundle, []byte("garbage")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := GetBundle(s, "acct", "example.com"); !errors.Is(err, ErrBadBundle) {
+		t.Errorf("GetBundle: got %v, want %v", err, ErrBadBundle)
+	}
+
+	leaf, key := mustGenerateCertificate("example.com")
+	ia := &stubIssuingAccount{cert: &acme.Certificate{Bytes: leaf, URI: "http://example.com/cert/1"}}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{"example.com"}}, key)
+	if err != nil {
+		t.Fatalf("CreateCertificateRequest failed: %v", err)
+	}
+
+	got, err := Issue(s, "acct", "example.com", acme.NewCertificateIssuer(ia), acme.TypeSolver{}, nil, key, csr)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	want := &Bundle{Key: key, Certificate: leaf}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Issue: got %+v, want %+v", got, want)
+	}
+	if _, err := GetBundle(s, "acct", "example.com"); err != nil {
+		t.Errorf("GetBundle failed: %v", err)
+	}
+}
+
+func TestIssueFollower(t *testing.T) {
+	dir := t.TempDir()
+	fl := NewFileLocker(dir)
+	hl := &hookLocker{Locker: fl, locking: make(chan struct{}, 1)}
+	s, err := NewFileStorage(dir, WithLocker(hl))
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+	leaf, key := mustGenerateCertificate("example.com")
+	want := &Bundle{Key: key, Certificate: leaf}
+
+	// The leader holds the lock while issuing.
+	unlock, err := fl.Lock("acct", "example.com")
+	if err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+
+	type result struct {
+		b   *Bundle
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		// The follower would fail if it tried to issue.
+		ia := &stubIssuingAccount{}
+		b, err := Issue(s, "acct", "example.com", acme.NewCertificateIssuer(ia), acme.TypeSolver{}, nil, key, nil)
+		done <- result{b, err}
+	}()
+
+	// The follower has read the stored certificate once it locks.
+	<-hl.locking
+	if err := PutBundle(s, "acct", "example.com", want); err != nil {
+		t.Fatalf("PutBundle failed: %v", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("Issue failed: %v", res.err)
+	}
+	if !reflect.DeepEqual(res.b, want) {
+		t.Errorf("Issue: got %+v, want %+v", res.b, want)
+	}
+}
+
+func TestIssueWithPrevious(t *testing.T) {
+	s, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+	old, oldKey := mustGenerateCertificate("example.com")
+	leaf, key := mustGenerateCertificate("example.com")
+	want := &Bundle{Key: key, Certificate: leaf}
+
+	// The leader finished before the follower called Issue, but
+	// after the follower read the old certificate.
+	if err := PutBundle(s, "acct", "example.com", want); err != nil {
+		t.Fatalf("PutBundle failed: %v", err)
+	}
+
+	ia := &stubIssuingAccount{}
+	got, err := Issue(s, "acct", "example.com", acme.NewCertificateIssuer(ia), acme.TypeSolver{}, nil, oldKey, nil, WithPrevious(old))
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Issue: got %+v, want %+v", got, want)
+	}
+}
+
+// hookLocker signals on locking before waiting for the lock.
+type hookLocker struct {
+	Locker
+	locking chan struct{}
+}
+
+func (l *hookLocker) Lock(account, name string) (func() error, error) {
+	select {
+	case l.locking <- struct{}{}:
+	default:
+	}
+	return l.Locker.Lock(account, name)
+}
+
+// stubIssuingAccount is an acme.IssuingAccount where all
+// authorizations are already valid.
+type stubIssuingAccount struct {
+	cert  *acme.Certificate
+	certs map[string]*acme.Certificate
+}
+
+func (ia *stubIssuingAccount) AuthorizeIdentity(id acme.Identifier) (*acme.Authorization, error) {
+	return &acme.Authorization{Status: protocol.StatusValid, Identifier: id}, nil
+}
+
+func (ia *stubIssuingAccount) Authorization(uri string) (*acme.Authorization, error) {
+	return nil, fmt.Errorf("unexpected Authorization(%q)", uri)
+}
+
+func (ia *stubIssuingAccount) ValidateChallenge(uri string, resp protocol.Response) (protocol.Challenge, error) {
+	return nil, fmt.Errorf("unexpected ValidateChallenge(%q)", uri)
+}
+
+func (ia *stubIssuingAccount) IssueCertificate(csr []byte) (*acme.Certificate, error) {
+	if ia.cert == nil {
+		return nil, errors.New("unexpected IssueCertificate")
+	}
+	return ia.cert, nil
+}
+
+func (ia *stubIssuingAccount) Certificate(uri string) (*acme.Certificate, error) {
+	c, ok := ia.certs[uri]
+	if !ok {
+		return nil, fmt.Errorf("no certificate %q", uri)
+	}
+	return c, nil
+}
+
+// mustGenerateCertificate creates a self-signed certificate.
+func mustGenerateCertificate(name string) ([]byte, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		panic(err)
+	}
+	return der, key
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	dirMode  os.FileMode = 0700
+	keyMode  os.FileMode = 0600
+	fileMode os.FileMode = 0644
+
+	accountsDir     = "accounts"
+	certificatesDir = "certificates"
+	locksDir        = "locks"
+)
+
+// A FileStorage is a Storage keeping items as files in a directory:
+//
+//	<root>/accounts/<account>/<kind>
+//	<root>/accounts/<account>/certificates/<name>/<kind>
+//
+// Private keys are only readable by the owner. Files are replaced
+// atomically with renames. By default, locks are file locks in
+// <root>/locks.
+type FileStorage struct {
+	root   string
+	locker Locker
+}
+
+// A FileStorageOpt is an option for NewFileStorage.
+type FileStorageOpt func(*FileStorage)
+
+// WithLocker makes the storage use the given locker, e.g. when
+// several hosts share the storage directory, but not file locks.
+func WithLocker(l Locker) FileStorageOpt {
+	return func(s *FileStorage) {
+		s.locker = l
+	}
+}
+
+// NewFileStorage creates a storage rooted at the given directory,
+// which is created if needed.
+func NewFileStorage(root string, opts ...FileStorageOpt) (*FileStorage, error) {
+	if err := os.MkdirAll(root, dirMode); err != nil {
+		return nil, err
+	}
+	s := &FileStorage{root: root}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.locker == nil {
+		s.locker = NewFileLocker(filepath.Join(root, locksDir))
+	}
+	return s, nil
+}
+
+func (s *FileStorage) Get(account, name string, kind Kind) ([]byte, error) {
+	p, err := s.path(account, name, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	bs, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return bs, err
+}
+
+func (s *FileStorage) Put(account, name string, kind Kind, data []byte) error {
+	p, err := s.path(account, name, kind)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), dirMode); err != nil {
+		return err
+	}
+
+	mode := fileMode
+	if kind == KindKey || kind == KindBundle {
+		mode = keyMode
+	}
+	return writeFileAtomic(p, data, mode)
+}
+
+func (s *FileStorage) Delete(account, name string) error {
+	p, err := s.path(account, name, "")
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return ErrInvalidName
+	}
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return os.RemoveAll(p)
+}
+
+func (s *FileStorage) List(account string) ([]string, error) {
+	if err := checkName(account); err != nil {
+		return nil, err
+	}
+	if account == "" {
+		return nil, ErrInvalidName
+	}
+
+	fis, err := ioutil.ReadDir(filepath.Join(s.root, accountsDir, account, certificatesDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var ret []string
+	for _, fi := range fis {
+		if fi.IsDir() {
+			ret = append(ret, fi.Name())
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// Lock locks a certificate name using the storage's Locker.
+func (s *FileStorage) Lock(account, name string) (func() error, error) {
+	if _, err := s.path(account, name, ""); err != nil {
+		return nil, err
+	}
+	return s.locker.Lock(account, name)
+}
+
+// path returns the file path of an item, or of the certificate
+// directory if kind is empty.
+func (s *FileStorage) path(account, name string, kind Kind) (string, error) {
+	for _, n := range []string{account, name, string(kind)} {
+		if err := checkName(n); err != nil {
+			return "", err
+		}
+	}
+	if account == "" {
+		return "", ErrInvalidName
+	}
+
+	p := filepath.Join(s.root, accountsDir, account)
+	if name != "" {
+		p = filepath.Join(p, certificatesDir, name)
+	}
+	return filepath.Join(p, string(kind)), nil
+}
+
+// writeFileAtomic writes data to a temporary file in the same
+// directory and renames it to path.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	renamed := false
+	defer func() {
+		if !renamed {
+			os.Remove(tmp)
+		}
+	}()
+
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	renamed = true
+	return nil
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileStorage(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+
+	if _, err := s.Get("acct", "example.com", KindCertificate); err != ErrNotFound {
+		t.Errorf("Get(missing): got %v, want %v", err, ErrNotFound)
+	}
+
+	for _, name := range []string{"example.com", "*.example.org"} {
+		if err := s.Put("acct", name, KindCertificate, []byte("cert "+name)); err != nil {
+			t.Fatalf("Put(%q) failed: %v", name, err)
+		}
+	}
+	if err := s.Put("acct", "example.com", KindBundle, []byte("bundle")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := s.Put("acct", "example.com", KindKey, []byte("key")); err != nil {
+		t.Fatalf("Put(key) failed: %v", err)
+	}
+	if err := s.Put("acct", "", KindKey, []byte("account key")); err != nil {
+		t.Fatalf("Put(account key) failed: %v", err)
+	}
+
+	got, err := s.Get("acct", "example.com", KindCertificate)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if want := "cert example.com"; string(got) != want {
+		t.Errorf("Get: got %q, want %q", got, want)
+	}
+
+	names, err := s.List("acct")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if want := []string{"*.example.org", "example.com"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("List: got %v, want %v", names, want)
+	}
+
+	fi, err := os.Stat(filepath.Join(dir, "accounts", "acct", "certificates", "example.com", string(KindKey)))
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if got, want := fi.Mode().Perm(), os.FileMode(0600); got != want {
+		t.Errorf("key mode: got %v, want %v", got, want)
+	}
+	fi, err = os.Stat(filepath.Join(dir, "accounts", "acct", "certificates", "example.com", string(KindBundle)))
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if got, want := fi.Mode().Perm(), os.FileMode(0600); got != want {
+		t.Errorf("bundle mode: got %v, want %v", got, want)
+	}
+	fi, err = os.Stat(filepath.Join(dir, "accounts", "acct", "certificates", "example.com", string(KindCertificate)))
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if got, want := fi.Mode().Perm(), os.FileMode(0644); got != want {
+		t.Errorf("certificate mode: got %v, want %v", got, want)
+	}
+
+	if err := s.Delete("acct", "example.com"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := s.Delete("acct", "example.com"); err != ErrNotFound {
+		t.Errorf("Delete(missing): got %v, want %v", err, ErrNotFound)
+	}
+	if _, err := s.Get("acct", "", KindKey); err != nil {
+		t.Errorf("Get(account key) failed: %v", err)
+	}
+}
+
+func TestFileStorageInvalidName(t *testing.T) {
+	s, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+
+	tsts := []struct {
+		account, name string
+	}{
+		{"", "example.com"},
+		{"..", "example.com"},
+		{"acct", "../example.com"},
+		{"acct", "a/b"},
+	}
+	for _, tst := range tsts {
+		if err := s.Put(tst.account, tst.name, KindCertificate, nil); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Put(%q, %q): got %v, want %v", tst.account, tst.name, err, ErrInvalidName)
+		}
+	}
+
+	for _, account := range []string{"", "..", "a/b"} {
+		if _, err := s.List(account); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("List(%q): got %v, want %v", account, err, ErrInvalidName)
+		}
+	}
+}
+
+func TestFileStorageLock(t *testing.T) {
+	s, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+
+	var mu sync.Mutex
+	var running, maxRunning int
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := s.Lock("acct", "example.com")
+			if err != nil {
+				t.Errorf("Lock failed: %v", err)
+				return
+			}
+			defer unlock()
+
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if maxRunning != 1 {
+		t.Errorf("Lock concurrency: got %v, want 1", maxRunning)
+	}
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// A Locker provides exclusive locks for certificate names, shared by
+// all processes that should not issue the same certificate at the
+// same time. Implementations backed by external services, e.g. a
+// database or a coordination service, can be given to NewFileStorage
+// with WithLocker.
+type Locker interface {
+	// Lock acquires an exclusive lock for a certificate name,
+	// blocking until it is available. An empty name locks the
+	// account itself. The returned function releases the lock.
+	Lock(account, name string) (unlock func() error, err error)
+}
+
+// A FileLocker is a Locker using advisory file locks, so that
+// processes sharing a directory, e.g. on a common volume, are
+// serialized. Locks are released by the operating system if the
+// process dies. On platforms without file locks, locks only apply
+// within the process.
+type FileLocker struct {
+	dir string
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// NewFileLocker creates a locker keeping lock files in the given
+// directory.
+func NewFileLocker(dir string) *FileLocker {
+	return &FileLocker{dir: dir, locks: map[string]*sync.Mutex{}}
+}
+
+func (l *FileLocker) Lock(account, name string) (func() error, error) {
+	for _, n := range []string{account, name} {
+		if err := checkName(n); err != nil {
+			return nil, err
+		}
+	}
+	if account == "" {
+		return nil, ErrInvalidName
+	}
+
+	// Goroutines wait in-process, so only one of them at a time
+	// blocks a thread on the file lock.
+	k := account + "/" + name
+	l.mu.Lock()
+	m, ok := l.locks[k]
+	if !ok {
+		m = &sync.Mutex{}
+		l.locks[k] = m
+	}
+	l.mu.Unlock()
+	m.Lock()
+
+	f, err := l.openLockFile(account, name)
+	if err != nil {
+		m.Unlock()
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		m.Unlock()
+		return nil, err
+	}
+
+	return func() error {
+		defer m.Unlock()
+		err := unlockFile(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
+
+// openLockFile opens the lock file of a certificate name. The lock
+// files are never removed, since that would race with other
+// processes opening them.
+func (l *FileLocker) openLockFile(account, name string) (*os.File, error) {
+	dir := filepath.Join(l.dir, account)
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(filepath.Join(dir, name+".lock"), os.O_RDWR|os.O_CREATE, keyMode)
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package storage
+
+import "os"
+
+// lockFile does nothing, leaving FileLocker with only in-process
+// locking.
+func lockFile(f *os.File) error { return nil }
+
+func unlockFile(f *os.File) error { return nil }
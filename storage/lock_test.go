@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFileLocker(t *testing.T) {
+	dir := t.TempDir()
+	// Separate lockers share nothing but the directory, like
+	// separate processes.
+	l1 := NewFileLocker(dir)
+	l2 := NewFileLocker(dir)
+
+	unlock, err := l1.Lock("acct", "example.com")
+	if err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+
+	locked := make(chan error)
+	go func() {
+		unlock2, err := l2.Lock("acct", "example.com")
+		if err == nil {
+			err = unlock2()
+		}
+		locked <- err
+	}()
+
+	select {
+	case err := <-locked:
+		t.Fatalf("Lock(second): got %v, want blocking", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Other names are independent.
+	unlockOther, err := l2.Lock("acct", "example.org")
+	if err != nil {
+		t.Fatalf("Lock(other) failed: %v", err)
+	}
+	if err := unlockOther(); err != nil {
+		t.Errorf("unlock(other) failed: %v", err)
+	}
+
+	if err := unlock(); err != nil {
+		t.Errorf("unlock failed: %v", err)
+	}
+	if err := <-locked; err != nil {
+		t.Errorf("Lock(second) failed: %v", err)
+	}
+}
+
+func TestFileLockerInvalidName(t *testing.T) {
+	l := NewFileLocker(t.TempDir())
+	if _, err := l.Lock("acct", "../example.com"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Lock: got %v, want %v", err, ErrInvalidName)
+	}
+}
+
+func TestWithLocker(t *testing.T) {
+	var l stubLocker
+	s, err := NewFileStorage(t.TempDir(), WithLocker(&l))
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+
+	unlock, err := s.Lock("acct", "example.com")
+	if err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if err := unlock(); err != nil {
+		t.Errorf("unlock failed: %v", err)
+	}
+	if want := []string{"acct/example.com"}; len(l.locked) != 1 || l.locked[0] != want[0] {
+		t.Errorf("Lock: got %v, want %v", l.locked, want)
+	}
+}
+
+type stubLocker struct {
+	locked []string
+}
+
+func (l *stubLocker) Lock(account, name string) (func() error, error) {
+	l.locked = append(l.locked, account+"/"+name)
+	return func() error { return nil }, nil
+}
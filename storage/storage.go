@@ -0,0 +1,74 @@
+// Package storage persists account and certificate data, such as
+// private keys and issued certificate chains.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrInvalidName = errors.New("invalid name")
+	ErrKeyMismatch = errors.New("private key does not match certificate")
+	ErrBadBundle   = errors.New("unparseable bundle")
+)
+
+// A Kind is a type of item stored for a certificate.
+type Kind string
+
+const (
+	// KindKey is the PEM encoded private key.
+	KindKey Kind = "privkey.pem"
+
+	// KindCertificate is the PEM encoded leaf certificate.
+	KindCertificate Kind = "cert.pem"
+
+	// KindChain is the PEM encoded issuer certificates.
+	KindChain Kind = "chain.pem"
+
+	// KindFullChain is the leaf and issuer certificates.
+	KindFullChain Kind = "fullchain.pem"
+
+	// KindBundle is the private key, leaf and issuer certificates
+	// as one item, so they are replaced together.
+	KindBundle Kind = "bundle.pem"
+
+	// KindConfig is application-defined configuration of a
+	// certificate, e.g. which names a renewal manager requests.
+	KindConfig Kind = "config.json"
+)
+
+// A Storage stores items by account, certificate name and kind. An
+// empty certificate name denotes items belonging to the account
+// itself, e.g. the account key. Implementations must be
+// concurrency-safe.
+type Storage interface {
+	// Get returns an item. Returns ErrNotFound if it doesn't exist.
+	Get(account, name string, kind Kind) ([]byte, error)
+
+	// Put creates or replaces an item. Readers see either the
+	// old or the new data.
+	Put(account, name string, kind Kind, data []byte) error
+
+	// Delete removes all items of a certificate. Returns
+	// ErrNotFound if there are none.
+	Delete(account, name string) error
+
+	// List returns the certificate names of an account, sorted.
+	List(account string) ([]string, error)
+
+	// Locker serializes issuance of a certificate name, across
+	// all users of the storage.
+	Locker
+}
+
+// checkName returns ErrInvalidName if s cannot be used as an account
+// or certificate name.
+func checkName(s string) error {
+	if s == "." || s == ".." || strings.ContainsAny(s, "/\\\x00") {
+		return fmt.Errorf("%w: %q", ErrInvalidName, s)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tommie/acme-go/protocol"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// A TLSALPN01Solver is a Solver for tls-alpn-01 challenges. It
+// creates the validation certificates, which a TLS server presents
+// by calling GetCertificate from its tls.Config.
+type TLSALPN01Solver struct {
+	accountKey *jose.JSONWebKey
+	cost       float64
+
+	mu    sync.Mutex
+	certs map[string]*tls.Certificate
+}
+
+// NewTLSALPN01Solver creates a solver. The account key is used to
+// compute validation values. The cost is per challenge.
+func NewTLSALPN01Solver(accountKey *jose.JSONWebKey, cost float64) *TLSALPN01Solver {
+	return &TLSALPN01Solver{
+		accountKey: accountKey,
+		cost:       cost,
+		certs:      map[string]*tls.Certificate{},
+	}
+}
+
+func (s *TLSALPN01Solver) Cost(cs []protocol.Challenge) (float64, error) {
+	for _, c := range cs {
+		if _, ok := c.(*protocol.TLSALPN01Challenge); !ok {
+			return 0, ErrUnsolvable
+		}
+	}
+
+	return s.cost * float64(len(cs)), nil
+}
+
+// Solve returns ErrNeedIdentifiers. Use SolveIdentifiers.
+func (s *TLSALPN01Solver) Solve(cs []protocol.Challenge) ([]protocol.Response, func() error, error) {
+	return nil, nil, ErrNeedIdentifiers
+}
+
+func (s *TLSALPN01Solver) SolveIdentifiers(ids []Identifier, cs []protocol.Challenge) ([]protocol.Response, func() error, error) {
+	var resps []protocol.Response
+	certs := map[string]*tls.Certificate{}
+	for i, c := range cs {
+		tc, ok := c.(*protocol.TLSALPN01Challenge)
+		if !ok {
+			return nil, nil, ErrUnsolvable
+		}
+		dnsID, ok := ids[i].(DNSIdentifier)
+		if !ok {
+			return nil, nil, ErrUnsolvable
+		}
+
+		resp, err := protocol.RespondTLSALPN01(tc)
+		if err != nil {
+			return nil, nil, err
+		}
+		cert, err := s.newCertificate(string(dnsID), tc.Token)
+		if err != nil {
+			return nil, nil, err
+		}
+		certs[strings.ToLower(string(dnsID))] = cert
+		resps = append(resps, resp)
+	}
+
+	s.mu.Lock()
+	for name, cert := range certs {
+		s.certs[name] = cert
+	}
+	s.mu.Unlock()
+
+	return resps, func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		for name, cert := range certs {
+			if s.certs[name] == cert {
+				delete(s.certs, name)
+			}
+		}
+		return nil
+	}, nil
+}
+
+// GetCertificate returns the validation certificate for a
+// tls-alpn-01 handshake. It can be used as tls.Config.GetCertificate
+// directly, or called when IsTLSALPN01Hello returns true.
+func (s *TLSALPN01Solver) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if !IsTLSALPN01Hello(hello) {
+		return nil, fmt.Errorf("not a %s handshake", TLSALPN01Protocol)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cert, ok := s.certs[strings.ToLower(hello.ServerName)]
+	if !ok {
+		return nil, fmt.Errorf("no tls-alpn-01 challenge for %q", hello.ServerName)
+	}
+	return cert, nil
+}
+
+// newCertificate creates a self-signed certificate holding the
+// validation value for a challenge. RFC 8737 Section 3.
+func (s *TLSALPN01Solver) newCertificate(name, token string) (*tls.Certificate, error) {
+	v, err := protocol.TLSALPN01Validation(token, s.accountKey)
+	if err != nil {
+		return nil, err
+	}
+	ext, err := asn1.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "ACME tls-alpn-01 challenge"},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		ExtraExtensions: []pkix.Extension{
+			{Id: idPEACMEIdentifier, Critical: true, Value: ext},
+		},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// IsTLSALPN01Hello returns whether a TLS handshake is a tls-alpn-01
+// validation request, which only offers the acme-tls/1 protocol.
+func IsTLSALPN01Hello(hello *tls.ClientHelloInfo) bool {
+	return len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == TLSALPN01Protocol
+}
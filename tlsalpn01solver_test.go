@@ -0,0 +1,91 @@
+package acme
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/tommie/acme-go/protocol"
+)
+
+func TestTLSALPN01SolverCost(t *testing.T) {
+	s := NewTLSALPN01Solver(testJWK, 2)
+
+	got, err := s.Cost([]protocol.Challenge{&protocol.TLSALPN01Challenge{}, &protocol.TLSALPN01Challenge{}})
+	if err != nil {
+		t.Fatalf("Cost failed: %v", err)
+	}
+	if want := 4.0; got != want {
+		t.Errorf("Cost: got %v, want %v", got, want)
+	}
+
+	if _, err := s.Cost([]protocol.Challenge{&protocol.HTTP01Challenge{}}); err != ErrUnsolvable {
+		t.Errorf("Cost(http-01): got %v, want %v", err, ErrUnsolvable)
+	}
+}
+
+func TestTLSALPN01SolverSolve(t *testing.T) {
+	s := NewTLSALPN01Solver(testJWK, 1)
+	c := &protocol.TLSALPN01Challenge{Resource: protocol.ResourceChallenge, Type: protocol.ChallengeTLSALPN01, Token: "tok"}
+
+	resps, stop, err := s.SolveIdentifiers([]Identifier{DNSIdentifier("localhost")}, []protocol.Challenge{c})
+	if err != nil {
+		t.Fatalf("SolveIdentifiers failed: %v", err)
+	}
+	if len(resps) != 1 || resps[0].GetType() != protocol.ChallengeTLSALPN01 {
+		t.Errorf("SolveIdentifiers: got %v, want one tls-alpn-01 response", resps)
+	}
+
+	l, err := tls.Listen("tcp", "localhost:0", &tls.Config{
+		GetCertificate: s.GetCertificate,
+		NextProtos:     []string{TLSALPN01Protocol},
+	})
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		t.Fatalf("SplitHostPort failed: %v", err)
+	}
+
+	sc := NewTLSALPN01SelfChecker(testJWK, port)
+	if err := sc.SelfCheck(DNSIdentifier("localhost"), c, resps[0]); err != nil {
+		t.Errorf("SelfCheck failed: %v", err)
+	}
+
+	if err := stop(); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+	hello := &tls.ClientHelloInfo{ServerName: "localhost", SupportedProtos: []string{TLSALPN01Protocol}}
+	if _, err := s.GetCertificate(hello); err == nil {
+		t.Errorf("GetCertificate after stop: got success, want error")
+	}
+}
+
+func TestIsTLSALPN01Hello(t *testing.T) {
+	tsts := []struct {
+		name   string
+		protos []string
+		want   bool
+	}{
+		{"acme", []string{TLSALPN01Protocol}, true},
+		{"none", nil, false},
+		{"mixed", []string{"h2", TLSALPN01Protocol}, false},
+	}
+	for _, tst := range tsts {
+		if got := IsTLSALPN01Hello(&tls.ClientHelloInfo{SupportedProtos: tst.protos}); got != tst.want {
+			t.Errorf("[%s] IsTLSALPN01Hello: got %v, want %v", tst.name, got, tst.want)
+		}
+	}
+}
@@ -72,11 +72,25 @@ func (i DNSIdentifier) String() string {
 	return "dns:" + string(i)
 }
 
+// An IPIdentifier is an IP address in textual form. RFC 8738.
+type IPIdentifier string
+
+func (i IPIdentifier) Protocol() *protocol.Identifier {
+	return &protocol.Identifier{Type: protocol.IP, Value: string(i)}
+}
+
+func (i IPIdentifier) String() string {
+	return "ip:" + string(i)
+}
+
 func newIdentifier(id protocol.Identifier) (Identifier, error) {
 	switch id.Type {
 	case protocol.DNS:
 		return DNSIdentifier(id.Value), nil
 
+	case protocol.IP:
+		return IPIdentifier(id.Value), nil
+
 	default:
 		return nil, fmt.Errorf("unknown identifier type %q in %v", id.Type, id)
 	}
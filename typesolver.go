@@ -2,6 +2,7 @@ package acme
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/tommie/acme-go/protocol"
 )
@@ -9,7 +10,11 @@ import (
 // A TypeSolver is a Solver split by challenge type. Each solver is
 // assigned challenges by type. If the same solver object is used for
 // multiple types, the challenges may be merged into a single call to
-// Solve.
+// Solve. Solvers are started in the order of their first challenge.
+//
+// A TypeSolver with IdentifierSolvers must be used through
+// SolveIdentifiers. Solve passes no identifiers, so those solvers
+// fail with ErrNeedIdentifiers.
 type TypeSolver map[protocol.ChallengeType]Solver
 
 func (s TypeSolver) Cost(cs []protocol.Challenge) (float64, error) {
@@ -31,67 +36,119 @@ func (s TypeSolver) Cost(cs []protocol.Challenge) (float64, error) {
 }
 
 func (s TypeSolver) Solve(cs []protocol.Challenge) ([]protocol.Response, func() error, error) {
+	return s.solve(nil, cs, nil, false)
+}
+
+func (s TypeSolver) SolveIdentifiers(ids []Identifier, cs []protocol.Challenge) ([]protocol.Response, func() error, error) {
+	return s.solve(ids, cs, nil, false)
+}
+
+// SolveIdentifiersCancel implements CancelableSolver, passing cancel
+// on to the assigned solvers that are CancelableSolvers.
+func (s TypeSolver) SolveIdentifiersCancel(ids []Identifier, cs []protocol.Challenge, cancel <-chan struct{}) ([]protocol.Response, func() error, error) {
+	return s.solve(ids, cs, cancel, false)
+}
+
+// solve starts all assigned solvers, sequentially or
+// concurrently. If any solver fails, all started solvers are stopped
+// and the error of the first failing solver, in assignment order, is
+// returned.
+func (s TypeSolver) solve(ids []Identifier, cs []protocol.Challenge, cancel <-chan struct{}, parallel bool) ([]protocol.Response, func() error, error) {
 	sacs, err := s.assignSolvers(cs)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	var stopFuncs []func() error
+	results := make([]solverResult, len(sacs))
+	if parallel {
+		var wg sync.WaitGroup
+		for i := range sacs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i] = sacs[i].solve(ids, cancel)
+			}(i)
+		}
+		wg.Wait()
+	} else {
+		for i := range sacs {
+			results[i] = sacs[i].solve(ids, cancel)
+			if results[i].err != nil {
+				break
+			}
+		}
+	}
+
 	stopAll := func() error {
 		var err error
-		for _, f := range stopFuncs {
-			ferr := f()
-			if ferr != nil {
+		for _, res := range results {
+			if res.stop == nil {
+				continue
+			}
+			if ferr := res.stop(); ferr != nil {
 				err = ferr
 			}
 		}
 		return err
 	}
-	errStop := stopAll
-	defer errStop()
 
 	allResps := make([]protocol.Response, len(cs))
-	for _, sac := range sacs {
-		resps, stop, err := sac.s.Solve(sac.cs)
-		if err != nil {
-			return nil, nil, err
-		}
-		stopFuncs = append(stopFuncs, stop)
-		if len(resps) != len(sac.cs) {
-			return nil, nil, fmt.Errorf("solver %v was given %d challenges, but returned %d responses", sac.s, len(sac.cs), len(resps))
+	for i, res := range results {
+		if res.err != nil {
+			stopAll()
+			return nil, nil, res.err
 		}
 		// Revert to original order.
-		for i := range sac.cs {
-			allResps[sac.cis[i]] = resps[i]
+		for j, ci := range sacs[i].cis {
+			allResps[ci] = res.resps[j]
 		}
 	}
 
-	errStop = func() error { return nil }
 	return allResps, stopAll, nil
 }
 
+// A ParallelTypeSolver is like TypeSolver, but starts the solvers
+// concurrently. This is useful if some solvers are slow to start,
+// e.g. when waiting for DNS propagation.
+type ParallelTypeSolver map[protocol.ChallengeType]Solver
+
+func (s ParallelTypeSolver) Cost(cs []protocol.Challenge) (float64, error) {
+	return TypeSolver(s).Cost(cs)
+}
+
+func (s ParallelTypeSolver) Solve(cs []protocol.Challenge) ([]protocol.Response, func() error, error) {
+	return TypeSolver(s).solve(nil, cs, nil, true)
+}
+
+func (s ParallelTypeSolver) SolveIdentifiers(ids []Identifier, cs []protocol.Challenge) ([]protocol.Response, func() error, error) {
+	return TypeSolver(s).solve(ids, cs, nil, true)
+}
+
+func (s ParallelTypeSolver) SolveIdentifiersCancel(ids []Identifier, cs []protocol.Challenge, cancel <-chan struct{}) ([]protocol.Response, func() error, error) {
+	return TypeSolver(s).solve(ids, cs, cancel, true)
+}
+
 // assignSolvers assigns the given challenges to solvers. Returns
-// ErrUnsolvable if any challenge has no solver. This should be
-// deterministic in the set of solvers and slice of challenges
-// provided.
+// ErrUnsolvable if any challenge has no solver. The result is
+// ordered by the index of the first challenge assigned to each
+// solver.
 func (s TypeSolver) assignSolvers(cs []protocol.Challenge) ([]solverChallenges, error) {
-	cmap := map[Solver]solverChallenges{}
+	var ret []solverChallenges
+	indices := map[Solver]int{}
 	for ci, ch := range cs {
 		s, ok := s[ch.GetType()]
 		if !ok {
 			// No solver for this challenge type.
 			return nil, ErrUnsolvable
 		}
-		sac := cmap[s]
-		sac.s = s
-		sac.cs = append(sac.cs, ch)
-		sac.cis = append(sac.cis, ci)
-		cmap[s] = sac
-	}
-
-	var ret []solverChallenges
-	for _, sacs := range cmap {
-		ret = append(ret, sacs)
+		i, ok := indices[s]
+		if !ok {
+			i = len(ret)
+			indices[s] = i
+			ret = append(ret, solverChallenges{s: s})
+		}
+		ret[i].cs = append(ret[i].cs, ch)
+		ret[i].cis = append(ret[i].cis, ci)
 	}
 
 	return ret, nil
@@ -102,3 +159,37 @@ type solverChallenges struct {
 	cs  []protocol.Challenge
 	cis []int
 }
+
+// solve runs the solver on the assigned challenges. ids are the
+// identifiers of all challenges, not only the assigned ones. If ids
+// is nil, the solver's Solve is called.
+func (sac *solverChallenges) solve(ids []Identifier, cancel <-chan struct{}) solverResult {
+	var resps []protocol.Response
+	var stop func() error
+	var err error
+	if ids == nil {
+		resps, stop, err = sac.s.Solve(sac.cs)
+	} else {
+		sids := make([]Identifier, len(sac.cis))
+		for i, ci := range sac.cis {
+			sids[i] = ids[ci]
+		}
+		resps, stop, err = solve(sac.s, sids, sac.cs, cancel)
+	}
+	if err != nil {
+		return solverResult{err: err}
+	}
+	if len(resps) != len(sac.cs) {
+		stop()
+		return solverResult{err: fmt.Errorf("solver %v was given %d challenges, but returned %d responses", sac.s, len(sac.cs), len(resps))}
+	}
+
+	return solverResult{resps: resps, stop: stop}
+}
+
+// solverResult is the outcome of solverChallenges.solve.
+type solverResult struct {
+	resps []protocol.Response
+	stop  func() error
+	err   error
+}
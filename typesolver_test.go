@@ -1,8 +1,8 @@
 package acme
 
 import (
+	"errors"
 	"reflect"
-	"sort"
 	"testing"
 
 	"github.com/tommie/acme-go/protocol"
@@ -142,6 +142,37 @@ func TestTypeSolverSolve(t *testing.T) {
 	}
 }
 
+func TestTypeSolverSolveIdentifiers(t *testing.T) {
+	dns01Solver := &stubIdentifierSolver{stubSolver: stubSolver{
+		resps: map[protocol.ChallengeType]protocol.Response{protocol.ChallengeDNS01: &protocol.DNS01Response{Type: protocol.ChallengeDNS01}},
+	}}
+	http01Solver := &stubSolver{
+		resps: map[protocol.ChallengeType]protocol.Response{protocol.ChallengeHTTP01: &protocol.HTTP01Response{Type: protocol.ChallengeHTTP01}},
+	}
+	s := TypeSolver{
+		protocol.ChallengeDNS01:  dns01Solver,
+		protocol.ChallengeHTTP01: http01Solver,
+	}
+	cs := []protocol.Challenge{
+		&protocol.HTTP01Challenge{Type: protocol.ChallengeHTTP01},
+		&protocol.DNS01Challenge{Type: protocol.ChallengeDNS01},
+	}
+	ids := []Identifier{DNSIdentifier("a.example.com"), DNSIdentifier("b.example.com")}
+
+	_, stop, err := s.SolveIdentifiers(ids, cs)
+	if err != nil {
+		t.Fatalf("SolveIdentifiers failed: %v", err)
+	}
+	stop()
+	if want := ids[1:]; !reflect.DeepEqual(dns01Solver.ids, want) {
+		t.Errorf("SolveIdentifiers ids: got %v, want %v", dns01Solver.ids, want)
+	}
+
+	if _, _, err := s.Solve(cs); err != ErrNeedIdentifiers {
+		t.Errorf("Solve: got %v, want %v", err, ErrNeedIdentifiers)
+	}
+}
+
 func TestTypeSolverAssignSolvers(t *testing.T) {
 	dns01Solver := &stubSolver{}
 	http01Solver := &stubSolver{}
@@ -171,6 +202,23 @@ func TestTypeSolverAssignSolvers(t *testing.T) {
 				{http01Solver, []protocol.Challenge{http01Challenge}, []int{1}},
 			},
 		},
+		{
+			name: "first index order",
+			sm: map[protocol.ChallengeType]Solver{
+				protocol.ChallengeDNS01:  dns01Solver,
+				protocol.ChallengeHTTP01: http01Solver,
+			},
+			cs: []protocol.Challenge{
+				http01Challenge,
+				dns01Challenge,
+				http01Challenge,
+			},
+
+			want: []solverChallenges{
+				{http01Solver, []protocol.Challenge{http01Challenge, http01Challenge}, []int{0, 2}},
+				{dns01Solver, []protocol.Challenge{dns01Challenge}, []int{1}},
+			},
+		},
 		{
 			name: "no solver",
 			cs: []protocol.Challenge{
@@ -186,40 +234,67 @@ func TestTypeSolverAssignSolvers(t *testing.T) {
 		if !matchError(err, tst.err) {
 			t.Errorf("[%s] assignSolvers failed: got %v, want prefix %v", tst.name, err, tst.err)
 		}
-		sort.Sort(bySolver(got))
-		sort.Sort(bySolver(tst.want))
 		if !reflect.DeepEqual(got, tst.want) {
 			t.Errorf("[%s] assignSolvers: got %v, want %v", tst.name, got, tst.want)
 		}
 	}
 }
 
-// bySolver creates a stable ordering, but only looks at pointer
-// equivalence for s and cs[i]. Just enough for test stability.
-type bySolver []solverChallenges
-
-func (sacs bySolver) Len() int { return len(sacs) }
-func (sacs bySolver) Less(i, j int) bool {
-	si := reflect.ValueOf(sacs[i].s).Pointer()
-	sj := reflect.ValueOf(sacs[j].s).Pointer()
-	if si != sj {
-		return si < sj
+func TestParallelTypeSolverSolve(t *testing.T) {
+	dns01Resp := &protocol.DNS01Response{Type: protocol.ChallengeDNS01}
+	http01Resp := &protocol.HTTP01Response{Type: protocol.ChallengeHTTP01}
+	dns01Solver := &stubSolver{
+		resps: map[protocol.ChallengeType]protocol.Response{protocol.ChallengeDNS01: dns01Resp},
+	}
+	http01Solver := &stubSolver{
+		resps: map[protocol.ChallengeType]protocol.Response{protocol.ChallengeHTTP01: http01Resp},
+	}
+	dns01Challenge := &protocol.DNS01Challenge{Type: protocol.ChallengeDNS01}
+	http01Challenge := &protocol.HTTP01Challenge{Type: protocol.ChallengeHTTP01}
+	s := ParallelTypeSolver{
+		protocol.ChallengeDNS01:  dns01Solver,
+		protocol.ChallengeHTTP01: http01Solver,
 	}
 
-	li := len(sacs[i].cs)
-	lj := len(sacs[j].cs)
-	if li != lj {
-		return li < lj
+	got, stop, err := s.Solve([]protocol.Challenge{http01Challenge, dns01Challenge, http01Challenge})
+	if err != nil {
+		t.Fatalf("Solve failed: %v", err)
+	}
+	if want := []protocol.Response{http01Resp, dns01Resp, http01Resp}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Solve: got %v, want %v", got, want)
+	}
+	if err := stop(); err != nil {
+		t.Errorf("Solve stop failed: %v", err)
 	}
+	if dns01Solver.stopped != 1 || http01Solver.stopped != 1 {
+		t.Errorf("Solve stopped: got %d, %d, want 1, 1", dns01Solver.stopped, http01Solver.stopped)
+	}
+}
 
-	for k := 0; k < li; k++ {
-		ci := reflect.ValueOf(sacs[i].cs[k]).Pointer()
-		cj := reflect.ValueOf(sacs[j].cs[k]).Pointer()
-		if ci != cj {
-			return ci < cj
+func TestTypeSolverSolvePartialFailure(t *testing.T) {
+	for _, parallel := range []bool{false, true} {
+		dns01Solver := &stubSolver{
+			resps: map[protocol.ChallengeType]protocol.Response{protocol.ChallengeDNS01: &protocol.DNS01Response{}},
+		}
+		http01Solver := &stubSolver{err: errors.New("mock error")}
+		tlsalpn01Solver := &stubSolver{err: errors.New("other error")}
+		s := TypeSolver{
+			protocol.ChallengeDNS01:     dns01Solver,
+			protocol.ChallengeHTTP01:    http01Solver,
+			protocol.ChallengeTLSALPN01: tlsalpn01Solver,
+		}
+		cs := []protocol.Challenge{
+			&protocol.DNS01Challenge{Type: protocol.ChallengeDNS01},
+			&protocol.HTTP01Challenge{Type: protocol.ChallengeHTTP01},
+			&protocol.TLSALPN01Challenge{Type: protocol.ChallengeTLSALPN01},
 		}
-	}
 
-	return false
+		_, _, err := s.solve(make([]Identifier, len(cs)), cs, nil, parallel)
+		if want := "mock error"; err == nil || err.Error() != want {
+			t.Errorf("[%v] solve: got %v, want %v", parallel, err, want)
+		}
+		if dns01Solver.stopped != 1 {
+			t.Errorf("[%v] solve stopped: got %d, want 1", parallel, dns01Solver.stopped)
+		}
+	}
 }
-func (sacs bySolver) Swap(i, j int) { sacs[i], sacs[j] = sacs[j], sacs[i] }
@@ -0,0 +1,204 @@
+package acme
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrCertificateKeyMismatch  = errors.New("public key does not match the CSR")
+	ErrCertificateNameMismatch = errors.New("names do not match the CSR")
+	ErrCertificateValidity     = errors.New("invalid validity period")
+	ErrCertificateChain        = errors.New("chain does not verify")
+)
+
+// maxClockSkew is how far in the future NotBefore may be, to allow
+// for clock differences between us and the CA.
+const maxClockSkew = 5 * time.Minute
+
+// An UnexpectedCertificateError is returned when a CA issues a
+// certificate that doesn't match the request. Err is one of the
+// ErrCertificate* errors.
+type UnexpectedCertificateError struct {
+	// URI is the certificate URI, if known.
+	URI    string
+	Err    error
+	Detail string
+}
+
+func (e *UnexpectedCertificateError) Error() string {
+	s := "unexpected certificate"
+	if e.URI != "" {
+		s += " " + e.URI
+	}
+	s += ": " + e.Err.Error()
+	if e.Detail != "" {
+		s += ": " + e.Detail
+	}
+	return s
+}
+
+func (e *UnexpectedCertificateError) Unwrap() error { return e.Err }
+
+// VerifyOptions control VerifyCertificate.
+type VerifyOptions struct {
+	// Roots, if not nil, are the trusted roots the chain must
+	// verify against.
+	Roots *x509.CertPool
+
+	// Intermediates are DER-encoded issuer certificates, e.g.
+	// fetched from Certificate.IssuerURIs. The first one, if any,
+	// must have signed the leaf.
+	Intermediates [][]byte
+
+	// Now is the time to check validity at. The zero value means
+	// the current time.
+	Now time.Time
+}
+
+// VerifyCertificate checks that an issued certificate matches a CSR:
+// the public key must be the same, the DNS names and IP addresses
+// must be exactly those requested, the validity period must include
+// the current time, and the chain must verify. The certificate can be
+// DER, or a PEM chain starting with the leaf, in which case the
+// remaining certificates are used as intermediates. Returns the
+// parsed leaf, or an *UnexpectedCertificateError.
+func VerifyCertificate(csr, cert []byte, opts VerifyOptions) (*x509.Certificate, error) {
+	req, err := x509.ParseCertificateRequest(csr)
+	if err != nil {
+		return nil, err
+	}
+
+	ders := [][]byte{cert}
+	if bytes.HasPrefix(bytes.TrimSpace(cert), []byte("-----BEGIN")) {
+		ders = pemCertificates(cert)
+		if len(ders) == 0 {
+			return nil, errors.New("no certificate in PEM data")
+		}
+	}
+	leaf, err := x509.ParseCertificate(ders[0])
+	if err != nil {
+		return nil, err
+	}
+	inters := append(append([][]byte(nil), ders[1:]...), opts.Intermediates...)
+
+	if !publicKeysEqual(leaf.PublicKey, req.PublicKey) {
+		return nil, &UnexpectedCertificateError{Err: ErrCertificateKeyMismatch}
+	}
+
+	if got, want := certificateNames(leaf), identifierNames(csrIdentifiers(req)); !stringsEqual(got, want) {
+		return nil, &UnexpectedCertificateError{
+			Err:    ErrCertificateNameMismatch,
+			Detail: fmt.Sprintf("got %v, want %v", got, want),
+		}
+	}
+
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if !leaf.NotAfter.After(leaf.NotBefore) || leaf.NotBefore.After(now.Add(maxClockSkew)) || !now.Before(leaf.NotAfter) {
+		return nil, &UnexpectedCertificateError{
+			Err:    ErrCertificateValidity,
+			Detail: fmt.Sprintf("%v to %v", leaf.NotBefore, leaf.NotAfter),
+		}
+	}
+
+	pool := x509.NewCertPool()
+	for i, der := range inters {
+		ic, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, &UnexpectedCertificateError{Err: ErrCertificateChain, Detail: err.Error()}
+		}
+		if i == 0 {
+			if err := leaf.CheckSignatureFrom(ic); err != nil {
+				return nil, &UnexpectedCertificateError{Err: ErrCertificateChain, Detail: err.Error()}
+			}
+		}
+		pool.AddCert(ic)
+	}
+	if opts.Roots != nil {
+		_, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         opts.Roots,
+			Intermediates: pool,
+			CurrentTime:   now,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return nil, &UnexpectedCertificateError{Err: ErrCertificateChain, Detail: err.Error()}
+		}
+	}
+
+	return leaf, nil
+}
+
+// certificateNames returns the sorted, lower-case DNS names and IP
+// addresses of a certificate, including the common name.
+func certificateNames(cert *x509.Certificate) []string {
+	names := map[string]bool{}
+	if cert.Subject.CommonName != "" {
+		names[strings.ToLower(cert.Subject.CommonName)] = true
+	}
+	for _, n := range cert.DNSNames {
+		names[strings.ToLower(n)] = true
+	}
+	for _, ip := range cert.IPAddresses {
+		names[ip.String()] = true
+	}
+
+	ret := make([]string, 0, len(names))
+	for n := range names {
+		ret = append(ret, n)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// identifierNames returns the sorted, lower-case values of
+// identifiers.
+func identifierNames(ids []Identifier) []string {
+	names := map[string]bool{}
+	for _, id := range ids {
+		names[strings.ToLower(id.Protocol().Value)] = true
+	}
+
+	ret := make([]string, 0, len(names))
+	for n := range names {
+		ret = append(ret, n)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// pemCertificates returns the contents of all CERTIFICATE blocks.
+func pemCertificates(bs []byte) [][]byte {
+	var ret [][]byte
+	for {
+		var b *pem.Block
+		b, bs = pem.Decode(bs)
+		if b == nil {
+			return ret
+		}
+		if b.Type == "CERTIFICATE" {
+			ret = append(ret, b.Bytes)
+		}
+	}
+}
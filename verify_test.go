@@ -0,0 +1,211 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tommie/acme-go/protocol"
+)
+
+func TestVerifyCertificate(t *testing.T) {
+	ca, caKey := mustGenerateTestCA("Test CA")
+	other, otherKey := mustGenerateTestCA("Other CA")
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	key := mustGenerateECDSAKey()
+	csr, err := NewCSR(IdentifiersFromNames("example.com", "192.0.2.1"), key)
+	if err != nil {
+		t.Fatalf("NewCSR failed: %v", err)
+	}
+	now := time.Now()
+	valid := mustIssueTestCertificate(ca, caKey, key.Public(), now.Add(-time.Hour), now.Add(time.Hour), "example.com", "192.0.2.1")
+	pemChain := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: valid}), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})...)
+
+	tsts := []struct {
+		name string
+		cert []byte
+		opts VerifyOptions
+
+		err error
+	}{
+		{name: "ok", cert: valid, opts: VerifyOptions{Roots: roots, Intermediates: [][]byte{ca.Raw}}},
+		{name: "noRoots", cert: valid},
+		{name: "pem", cert: pemChain, opts: VerifyOptions{Roots: roots}},
+		{
+			name: "key",
+			cert: mustIssueTestCertificate(ca, caKey, mustGenerateECDSAKey().Public(), now.Add(-time.Hour), now.Add(time.Hour), "example.com", "192.0.2.1"),
+			err:  ErrCertificateKeyMismatch,
+		},
+		{
+			name: "missingName",
+			cert: mustIssueTestCertificate(ca, caKey, key.Public(), now.Add(-time.Hour), now.Add(time.Hour), "example.com"),
+			err:  ErrCertificateNameMismatch,
+		},
+		{
+			name: "extraName",
+			cert: mustIssueTestCertificate(ca, caKey, key.Public(), now.Add(-time.Hour), now.Add(time.Hour), "example.com", "192.0.2.1", "example.org"),
+			err:  ErrCertificateNameMismatch,
+		},
+		{
+			name: "expired",
+			cert: mustIssueTestCertificate(ca, caKey, key.Public(), now.Add(-2*time.Hour), now.Add(-time.Hour), "example.com", "192.0.2.1"),
+			err:  ErrCertificateValidity,
+		},
+		{
+			name: "future",
+			cert: mustIssueTestCertificate(ca, caKey, key.Public(), now.Add(time.Hour), now.Add(2*time.Hour), "example.com", "192.0.2.1"),
+			err:  ErrCertificateValidity,
+		},
+		{
+			name: "wrongIssuer",
+			cert: valid,
+			opts: VerifyOptions{Intermediates: [][]byte{other.Raw}},
+			err:  ErrCertificateChain,
+		},
+		{
+			name: "untrusted",
+			cert: mustIssueTestCertificate(other, otherKey, key.Public(), now.Add(-time.Hour), now.Add(time.Hour), "example.com", "192.0.2.1"),
+			opts: VerifyOptions{Roots: roots},
+			err:  ErrCertificateChain,
+		},
+	}
+	for _, tst := range tsts {
+		_, err := VerifyCertificate(csr, tst.cert, tst.opts)
+		if !errors.Is(err, tst.err) {
+			t.Errorf("[%s] VerifyCertificate: got %v, want %v", tst.name, err, tst.err)
+		}
+		if tst.err != nil {
+			var ue *UnexpectedCertificateError
+			if !errors.As(err, &ue) {
+				t.Errorf("[%s] VerifyCertificate: got %T, want *UnexpectedCertificateError", tst.name, err)
+			}
+		}
+	}
+}
+
+func TestCertificateIssuerVerification(t *testing.T) {
+	ca, caKey := mustGenerateTestCA("Test CA")
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	key := mustGenerateECDSAKey()
+	csr, err := NewCSR(IdentifiersFromNames("example.com"), key)
+	if err != nil {
+		t.Fatalf("NewCSR failed: %v", err)
+	}
+	now := time.Now()
+
+	tsts := []struct {
+		name      string
+		names     []string
+		issuerURI string
+
+		err error
+	}{
+		{name: "ok", names: []string{"example.com"}},
+		{name: "mismatch", names: []string{"example.org"}, err: ErrCertificateNameMismatch},
+		{name: "unfetchable", names: []string{"example.com"}, issuerURI: "http://example.com/missing", err: ErrCertificateChain},
+	}
+	for _, tst := range tsts {
+		if tst.issuerURI == "" {
+			tst.issuerURI = "http://example.com/ca"
+		}
+		ia := &stubCertificateGetter{
+			stubIssuingAccount: stubIssuingAccount{
+				authzID: func(id Identifier) (*Authorization, error) {
+					return &Authorization{Status: protocol.StatusValid}, nil
+				},
+				issue: func(csr []byte) (*Certificate, error) {
+					return &Certificate{
+						Bytes:      mustIssueTestCertificate(ca, caKey, key.Public(), now.Add(-time.Hour), now.Add(time.Hour), tst.names...),
+						URI:        "http://example.com/cert/1",
+						IssuerURIs: []string{tst.issuerURI},
+					}, nil
+				},
+			},
+			certs: map[string]*Certificate{"http://example.com/ca": {Bytes: ca.Raw}},
+		}
+
+		cert, err := NewCertificateIssuer(ia, WithVerification(roots)).AuthorizeAndIssue(csr, &stubSolver{})
+		if !errors.Is(err, tst.err) {
+			t.Errorf("[%s] AuthorizeAndIssue: got %v, want %v", tst.name, err, tst.err)
+		}
+		if tst.err == nil {
+			if cert == nil {
+				t.Errorf("[%s] AuthorizeAndIssue: got nil certificate", tst.name)
+			}
+			continue
+		}
+		var ue *UnexpectedCertificateError
+		if !errors.As(err, &ue) || ue.URI != "http://example.com/cert/1" {
+			t.Errorf("[%s] AuthorizeAndIssue: got %#v, want URI %q", tst.name, err, "http://example.com/cert/1")
+		}
+	}
+}
+
+type stubCertificateGetter struct {
+	stubIssuingAccount
+	certs map[string]*Certificate
+}
+
+func (ia *stubCertificateGetter) Certificate(uri string) (*Certificate, error) {
+	c, ok := ia.certs[uri]
+	if !ok {
+		return nil, errors.New("no such certificate")
+	}
+	return c, nil
+}
+
+// mustGenerateTestCA creates a self-signed CA certificate.
+func mustGenerateTestCA(name string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key := mustGenerateECDSAKey()
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-24 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	return cert, key
+}
+
+// mustIssueTestCertificate creates a certificate for the names,
+// which can be DNS names or IP addresses, signed by the CA.
+func mustIssueTestCertificate(ca *x509.Certificate, caKey crypto.Signer, pub crypto.PublicKey, notBefore, notAfter time.Time, names ...string) []byte {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	for _, n := range names {
+		if ip := net.ParseIP(n); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, n)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, pub, caKey)
+	if err != nil {
+		panic(err)
+	}
+	return der
+}